@@ -10,6 +10,8 @@ import (
 
 type ApplyFlags struct {
 	*RootFlags
+
+	Clusters ClustersFlag
 }
 
 // NewApplyCommand returns the "apply" command
@@ -31,13 +33,21 @@ func NewApplyCommand(rf *RootFlags) *cobra.Command {
 	return cmd
 }
 
-func addApplyFlags(fs *pflag.FlagSet, af *ApplyFlags) {}
+func addApplyFlags(fs *pflag.FlagSet, af *ApplyFlags) {
+	AddClustersFlag(fs, &af.Clusters)
+}
 
 func RunApply(af *ApplyFlags) error {
 	ctx := util.NewContext(af.DryRun, af.RootDir)
+	ctx = util.WithFailFast(ctx, af.FailFast)
+	ctx = util.WithGenerateCredentials(ctx, true)
 	cfg, err := loadConfig(ctx, af.ConfigPath)
 	if err != nil {
 		return err
 	}
-	return apply.Apply(ctx, cfg)
+	clusters, err := af.Clusters.Numbers(cfg)
+	if err != nil {
+		return err
+	}
+	return apply.Apply(ctx, cfg, clusters)
 }
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"sort"
 
 	"github.com/cloud-native-nordics/workshopctl/pkg/config"
 	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
@@ -14,6 +16,12 @@ import (
 
 type CleanupFlags struct {
 	*RootFlags
+
+	Force    bool
+	Excess   bool
+	Orphans  bool
+	Yes      bool
+	Clusters ClustersFlag
 }
 
 // NewCleanupCommand returns the "cleanup" command
@@ -35,10 +43,19 @@ func NewCleanupCommand(rf *RootFlags) *cobra.Command {
 	return cmd
 }
 
-func addCleanupFlags(fs *pflag.FlagSet, cf *CleanupFlags) {}
+func addCleanupFlags(fs *pflag.FlagSet, cf *CleanupFlags) {
+	fs.BoolVar(&cf.Force, "force", cf.Force, "Delete all DNS records under the cluster domains, also those without an external-dns ownership record")
+	fs.BoolVar(&cf.Excess, "excess", cf.Excess, "Only delete the existing clusters above the amount of clusters in the config, e.g. after lowering it")
+	fs.BoolVar(&cf.Orphans, "orphans", cf.Orphans, "Instead of deleting clusters, delete the resources in the whole account that outlived their clusters, e.g. load balancers, volumes and DNS records")
+	fs.BoolVarP(&cf.Yes, "yes", "y", cf.Yes, "Don't ask for confirmation before deleting orphaned resources")
+	// Unlike for the other commands, clusters above the amount in the config may be selected
+	fs.Var(&cf.Clusters, "clusters", "Only delete these clusters, as a comma-separated list of numbers and ranges, e.g. 3,5-8. By default, all clusters are deleted.")
+}
 
 func RunCleanup(cf *CleanupFlags) error {
 	ctx := util.NewContext(cf.DryRun, cf.RootDir)
+	ctx = util.WithFailFast(ctx, cf.FailFast)
+	ctx = util.WithForce(ctx, cf.Force)
 
 	cfg, err := loadConfig(ctx, cf.ConfigPath)
 	if err != nil {
@@ -55,7 +72,30 @@ func RunCleanup(cf *CleanupFlags) error {
 		return err
 	}
 
-	return config.ForCluster(ctx, cfg.Clusters, cfg, func(clusterCtx context.Context, clusterInfo *config.ClusterInfo) error {
+	var clusters config.ClusterNumbers
+	switch {
+	case cf.Orphans && (cf.Excess || cf.Clusters.IsSet()):
+		return fmt.Errorf("--orphans can't be combined with --excess or --clusters")
+	case cf.Orphans:
+		return cleanupOrphans(ctx, cfg, cloudP, dnsP, cf.Yes)
+	case cf.Excess && cf.Clusters.IsSet():
+		return fmt.Errorf("--excess and --clusters are mutually exclusive")
+	case cf.Excess:
+		if clusters, err = excessClusters(ctx, cfg, cloudP); err != nil {
+			return err
+		}
+		if len(clusters) == 0 {
+			log.Infof("There are no clusters above the configured %d clusters", cfg.Clusters)
+			return nil
+		}
+		log.Infof("Deleting the clusters above the configured %d clusters: %s", cfg.Clusters, clusters)
+	case cf.Clusters.IsSet():
+		clusters = cf.Clusters.numbers
+	default:
+		clusters = config.AllClusters(cfg.Clusters)
+	}
+
+	return config.ForCluster(ctx, clusters, cfg, func(clusterCtx context.Context, clusterInfo *config.ClusterInfo) error {
 		// TODO: Create helper func for this
 		clusterMeta := provider.ClusterMeta{
 			NamePrefix: clusterInfo.Name,
@@ -72,6 +112,26 @@ func RunCleanup(cf *CleanupFlags) error {
 			return err
 		}
 		// Delete the DNS records
+		unlock := util.Lock(clusterCtx, util.LockDNS)
+		defer unlock()
 		return dnsP.CleanupRecords(clusterCtx, clusterMeta)
 	})
 }
+
+// excessClusters returns the existing clusters with a number above the amount in the config
+func excessClusters(ctx context.Context, cfg *config.Config, cloudP provider.CloudProvider) (config.ClusterNumbers, error) {
+	existing, err := cloudP.ListClusters(ctx, cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	clusters := config.ClusterNumbers{}
+	for _, c := range existing {
+		if uint16(c.Index) > cfg.Clusters {
+			clusters = append(clusters, c.Index)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i] < clusters[j]
+	})
+	return clusters, nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/cost"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/providers"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type CostFlags struct {
+	*RootFlags
+
+	Duration time.Duration
+}
+
+// NewCostCommand returns the "cost" command
+func NewCostCommand(rf *RootFlags) *cobra.Command {
+	cf := &CostFlags{
+		RootFlags: rf,
+	}
+	cmd := &cobra.Command{
+		Use:   "cost",
+		Short: "Estimate what the clusters cost per cluster, per hour and in total",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunCost(cf); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	addCostFlags(cmd.Flags(), cf)
+	return cmd
+}
+
+func addCostFlags(fs *pflag.FlagSet, cf *CostFlags) {
+	fs.DurationVarP(&cf.Duration, "duration", "d", cf.Duration, "How long the clusters are planned to run. Defaults to the duration of the budget in the config, or 8h")
+}
+
+func RunCost(cf *CostFlags) error {
+	// Estimating only reads prices, hence always dry-run to be on the safe side
+	ctx := util.NewContext(true, cf.RootDir)
+	cfg, err := loadConfig(ctx, cf.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	cloudP, err := providers.CloudProviders().NewCloudProvider(ctx, &cfg.CloudProvider)
+	if err != nil {
+		return err
+	}
+
+	d := cf.Duration
+	if d == 0 {
+		d = cfg.Budget.PlannedDuration()
+	}
+	e, err := cost.Compute(ctx, cfg, cloudP, cfg.Clusters, d)
+	if err != nil {
+		return err
+	}
+	if err := cost.Write(os.Stdout, e); err != nil {
+		return err
+	}
+	if cfg.Budget.Amount != 0 && e.Total > cfg.Budget.Amount {
+		log.Warnf("The estimate is above the budget of %.2f %s", cfg.Budget.Amount, e.Currency)
+	}
+	return nil
+}
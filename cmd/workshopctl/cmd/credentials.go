@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/handout"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type CredentialsFlags struct {
+	*RootFlags
+
+	Format     string
+	OutputFile string
+	QRCodes    bool
+}
+
+// NewCredentialsCommand returns the "credentials" command
+func NewCredentialsCommand(rf *RootFlags) *cobra.Command {
+	cf := &CredentialsFlags{
+		RootFlags: rf,
+		Format:    string(handout.FormatMarkdown),
+	}
+	cmd := &cobra.Command{
+		Use:   "credentials",
+		Short: "Export the cluster URLs and credentials as attendee handouts",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunCredentials(cf); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	addCredentialsFlags(cmd.Flags(), cf)
+	return cmd
+}
+
+func addCredentialsFlags(fs *pflag.FlagSet, cf *CredentialsFlags) {
+	fs.StringVarP(&cf.Format, "format", "f", cf.Format, fmt.Sprintf("What format to export the handouts in. One of %v", handout.Formats))
+	fs.StringVarP(&cf.OutputFile, "output", "o", cf.OutputFile, "File to write the handouts to. By default, the handouts are written to stdout.")
+	fs.BoolVar(&cf.QRCodes, "qr-codes", cf.QRCodes, "Include QR codes pointing to the Visual Studio Code URL (markdown and html only)")
+}
+
+func RunCredentials(cf *CredentialsFlags) error {
+	// Don't dry-run, no need for that
+	ctx := util.NewContext(false, cf.RootDir)
+	ctx = util.WithFailFast(ctx, cf.FailFast)
+	cfg, err := loadConfig(ctx, cf.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	handouts, err := handout.Collect(ctx, cfg, cf.QRCodes)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := handout.Write(&buf, handouts, handout.Format(cf.Format)); err != nil {
+		return err
+	}
+	if len(cf.OutputFile) == 0 {
+		_, err := buf.WriteTo(os.Stdout)
+		return err
+	}
+	log.Infof("Writing handouts for %d clusters to %q", len(handouts), cf.OutputFile)
+	// The handouts contain passwords, hence restrict the permissions
+	return os.WriteFile(cf.OutputFile, buf.Bytes(), 0600)
+}
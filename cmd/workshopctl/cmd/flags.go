@@ -12,6 +12,8 @@ import (
 const (
 	EnvCluster     = "WORKSHOPCTL_CLUSTER"
 	EnvClusterDesc = "What cluster number you want to connect to. Env var " + EnvCluster + " can also be used."
+
+	ClustersDesc = "Only operate on these clusters, as a comma-separated list of numbers and ranges, e.g. 3,5-8. By default, all clusters are selected."
 )
 
 type ClusterFlag uint16
@@ -45,3 +47,44 @@ func (f ClusterFlag) Number() config.ClusterNumber {
 func AddClusterFlag(fs *pflag.FlagSet, cf *ClusterFlag) {
 	fs.VarP(cf, "cluster", "c", EnvClusterDesc)
 }
+
+// ClustersFlag selects a subset of the clusters, e.g. "3,5-8"
+type ClustersFlag struct {
+	numbers config.ClusterNumbers
+}
+
+func (f *ClustersFlag) String() string {
+	return f.numbers.String()
+}
+func (f *ClustersFlag) Set(str string) error {
+	numbers, err := config.ParseClusterNumbers(str)
+	if err != nil {
+		return err
+	}
+	f.numbers = numbers
+	return nil
+}
+func (f *ClustersFlag) Type() string { return "cluster-numbers" }
+
+// IsSet tells whether any clusters were selected
+func (f *ClustersFlag) IsSet() bool {
+	return len(f.numbers) != 0
+}
+
+// Numbers returns the selected clusters, or all clusters in the config if none were selected.
+// Selecting clusters above the amount of clusters in the config is an error.
+func (f *ClustersFlag) Numbers(cfg *config.Config) (config.ClusterNumbers, error) {
+	if !f.IsSet() {
+		return config.AllClusters(cfg.Clusters), nil
+	}
+	for _, n := range f.numbers {
+		if uint16(n) > cfg.Clusters {
+			return nil, fmt.Errorf("cluster %s is selected, but only %d clusters are configured", n, cfg.Clusters)
+		}
+	}
+	return f.numbers, nil
+}
+
+func AddClustersFlag(fs *pflag.FlagSet, cf *ClustersFlag) {
+	fs.Var(cf, "clusters", ClustersDesc)
+}
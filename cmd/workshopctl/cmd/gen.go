@@ -19,6 +19,7 @@ type GenFlags struct {
 	*RootFlags
 
 	SkipLocalCharts bool
+	Clusters        ClustersFlag
 }
 
 // NewGenCommand returns the "gen" command
@@ -43,6 +44,7 @@ func NewGenCommand(rf *RootFlags) *cobra.Command {
 
 func addGenFlags(fs *pflag.FlagSet, gf *GenFlags) {
 	fs.BoolVar(&gf.SkipLocalCharts, "skip-local-charts", gf.SkipLocalCharts, "Don't consider the local directory's charts/ directory")
+	AddClustersFlag(fs, &gf.Clusters)
 }
 
 func loadConfig(ctx context.Context, configPath string) (*config.Config, error) {
@@ -58,11 +60,18 @@ func loadConfig(ctx context.Context, configPath string) (*config.Config, error)
 
 func RunGen(gf *GenFlags) error {
 	ctx := util.NewContext(gf.DryRun, gf.RootDir)
+	ctx = util.WithFailFast(ctx, gf.FailFast)
+	ctx = util.WithGenerateCredentials(ctx, true)
 	cfg, err := loadConfig(ctx, gf.ConfigPath)
 	if err != nil {
 		return err
 	}
 
+	clusters, err := gf.Clusters.Numbers(cfg)
+	if err != nil {
+		return err
+	}
+
 	charts, err := gen.SetupInternalChartCache(ctx)
 	if err != nil {
 		return err
@@ -94,7 +103,7 @@ func RunGen(gf *GenFlags) error {
 		return err
 	}
 
-	err = config.ForCluster(ctx, cfg.Clusters, cfg, func(clusterCtx context.Context, clusterInfo *config.ClusterInfo) error {
+	err = config.ForCluster(ctx, clusters, cfg, func(clusterCtx context.Context, clusterInfo *config.ClusterInfo) error {
 		for _, chart := range charts {
 			logger := util.Logger(ctx)
 			logger.Infof("Generating chart %q...", chart.Name)
@@ -102,6 +111,10 @@ func RunGen(gf *GenFlags) error {
 				return err
 			}
 		}
+		// If enabled, commit the workshopctl Secret encrypted to git instead of pushing it at apply-time
+		if clusterInfo.Secrets.Enabled() {
+			return gen.GenerateSecret(clusterCtx, clusterInfo)
+		}
 		return nil
 	})
 	if err != nil {
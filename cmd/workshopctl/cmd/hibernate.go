@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/cloud-native-nordics/workshopctl/pkg/apply"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type HibernateFlags struct {
+	*RootFlags
+
+	Clusters ClustersFlag
+}
+
+// NewHibernateCommand returns the "hibernate" command
+func NewHibernateCommand(rf *RootFlags) *cobra.Command {
+	hf := &HibernateFlags{
+		RootFlags: rf,
+	}
+	cmd := &cobra.Command{
+		Use:   "hibernate",
+		Short: "Scale the nodes of the clusters down between workshop days",
+		Long: `Scale the node groups of the clusters down to the least amount of nodes the cloud
+provider allows, e.g. between the days of a multi-day workshop. The clusters are kept, and so
+are their state, DNS records and credentials. Run resume to scale the node groups back up.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunHibernate(hf); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	addHibernateFlags(cmd.Flags(), hf)
+	return cmd
+}
+
+func addHibernateFlags(fs *pflag.FlagSet, hf *HibernateFlags) {
+	AddClustersFlag(fs, &hf.Clusters)
+}
+
+func RunHibernate(hf *HibernateFlags) error {
+	ctx := util.NewContext(hf.DryRun, hf.RootDir)
+	ctx = util.WithFailFast(ctx, hf.FailFast)
+	cfg, err := loadConfig(ctx, hf.ConfigPath)
+	if err != nil {
+		return err
+	}
+	clusters, err := hf.Clusters.Numbers(cfg)
+	if err != nil {
+		return err
+	}
+	return apply.Hibernate(ctx, cfg, clusters)
+}
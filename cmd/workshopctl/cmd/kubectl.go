@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
 	"github.com/cloud-native-nordics/workshopctl/pkg/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -13,7 +15,8 @@ import (
 type KubectlFlags struct {
 	*RootFlags
 
-	Cluster ClusterFlag
+	Cluster  ClusterFlag
+	Clusters ClustersFlag
 }
 
 // NewKubectlCommand returns the "kubectl" command
@@ -37,16 +40,32 @@ func NewKubectlCommand(rf *RootFlags) *cobra.Command {
 
 func addKubectlFlags(fs *pflag.FlagSet, kf *KubectlFlags) {
 	AddClusterFlag(fs, &kf.Cluster)
+	fs.Var(&kf.Clusters, "clusters", "Run the kubectl command against each of these clusters in turn, as a comma-separated list of numbers and ranges, e.g. 3,5-8")
 }
 
 func RunKubectl(kf *KubectlFlags, args []string) error {
-	if kf.Cluster == 0 {
-		return fmt.Errorf("--cluster is required")
+	ctx := util.NewContext(false, kf.RootDir)
+
+	if kf.Clusters.IsSet() {
+		if kf.Cluster != 0 {
+			return fmt.Errorf("--cluster and --clusters are mutually exclusive")
+		}
+		for _, cn := range kf.Clusters.numbers {
+			fmt.Fprintf(os.Stdout, "# Cluster %s\n", cn)
+			if err := runKubectl(ctx, cn, args); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	ctx := util.NewContext(false, kf.RootDir)
+	if kf.Cluster == 0 {
+		return fmt.Errorf("--cluster or --clusters is required")
+	}
+	return runKubectl(ctx, kf.Cluster.Number(), args)
+}
 
-	cn := kf.Cluster.Number()
+func runKubectl(ctx context.Context, cn config.ClusterNumber, args []string) error {
 	kubeconfigPath := util.JoinPaths(ctx, cn.KubeConfigPath())
 	kubeconfigEnv := fmt.Sprintf("KUBECONFIG=%s", kubeconfigPath)
 	_, _, err := util.Command(ctx, "kubectl", args...).
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// staleRecords are the DNS records of a cluster that doesn't exist
+type staleRecords struct {
+	m       provider.ClusterMeta
+	records []provider.DNSRecord
+}
+
+// cleanupOrphans shows the resources that outlived their clusters, and deletes them after
+// confirmation. DNS records are only looked for under the domains of the configured clusters.
+func cleanupOrphans(ctx context.Context, cfg *config.Config, cloudP provider.CloudProvider, dnsP provider.DNSProvider, yes bool) error {
+	orphans := []provider.Orphan{}
+	op, ok := cloudP.(provider.OrphansProvider)
+	if ok {
+		var err error
+		if orphans, err = op.ListOrphans(ctx); err != nil {
+			return err
+		}
+	} else {
+		log.Warnf("Cloud provider %q can't tell which resources are orphaned", cfg.CloudProvider.Name)
+	}
+
+	stale, err := listStaleRecords(ctx, cfg, cloudP, dnsP)
+	if err != nil {
+		return err
+	}
+
+	count := len(orphans)
+	for _, s := range stale {
+		count += len(s.records)
+	}
+	if count == 0 {
+		log.Info("There are no orphaned resources")
+		return nil
+	}
+	if err := writeOrphans(os.Stdout, orphans, stale); err != nil {
+		return err
+	}
+
+	if util.IsDryRun(ctx) {
+		log.Infof("Not deleting the %d orphaned resources, as this is a dry-run", count)
+		return nil
+	}
+	if !yes && !confirm(os.Stdin, os.Stdout, fmt.Sprintf("Delete these %d resources?", count)) {
+		log.Info("Not deleting anything")
+		return nil
+	}
+
+	for _, o := range orphans {
+		if err := op.DeleteOrphan(ctx, o); err != nil {
+			return err
+		}
+	}
+	for _, s := range stale {
+		if err := dnsP.CleanupRecords(ctx, s.m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listStaleRecords returns the records that CleanupRecords would delete for the configured
+// clusters that don't exist
+func listStaleRecords(ctx context.Context, cfg *config.Config, cloudP provider.CloudProvider, dnsP provider.DNSProvider) ([]staleRecords, error) {
+	lister, ok := dnsP.(provider.RecordsLister)
+	if !ok {
+		log.Warnf("DNS provider %q can't list records, hence stale records aren't looked for", cfg.DNSProvider.Name)
+		return nil, nil
+	}
+
+	existing, err := cloudP.ListClusters(ctx, cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	exists := map[config.ClusterNumber]bool{}
+	for _, c := range existing {
+		exists[c.Index] = true
+	}
+
+	stale := []staleRecords{}
+	for _, i := range config.AllClusters(cfg.Clusters) {
+		if exists[i] {
+			continue
+		}
+		m := provider.ClusterMeta{NamePrefix: cfg.Name, Index: i}
+		records, err := lister.ListRecords(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		if !util.IsForce(ctx) {
+			records = provider.OwnedRecords(records, i.Domain(cfg.RootDomain))
+		}
+		if len(records) != 0 {
+			stale = append(stale, staleRecords{m, records})
+		}
+	}
+	return stale, nil
+}
+
+func writeOrphans(w io.Writer, orphans []provider.Orphan, stale []staleRecords) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tID\tREASON")
+	for _, o := range orphans {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Kind, o.Name, o.ID, o.Reason)
+	}
+	for _, s := range stale {
+		for _, r := range s.records {
+			fmt.Fprintf(tw, "DNS record\t%s %s\t\tcluster %s doesn't exist\n", r.Type, r.Name, s.m.Name())
+		}
+	}
+	return tw.Flush()
+}
+
+// confirm asks the question, and tells whether it was answered with yes
+func confirm(r io.Reader, w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
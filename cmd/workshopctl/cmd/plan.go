@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/plan"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/providers"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type PlanFlags struct {
+	*RootFlags
+
+	Format string
+}
+
+// NewPlanCommand returns the "plan" command
+func NewPlanCommand(rf *RootFlags) *cobra.Command {
+	pf := &PlanFlags{
+		RootFlags: rf,
+		Format:    string(plan.FormatText),
+	}
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show what clusters apply would create, and which differ from the config or are in excess",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunPlan(pf); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	addPlanFlags(cmd.Flags(), pf)
+	return cmd
+}
+
+func addPlanFlags(fs *pflag.FlagSet, pf *PlanFlags) {
+	fs.StringVarP(&pf.Format, "format", "f", pf.Format, fmt.Sprintf("What format to output the plan in. One of %v", plan.Formats))
+}
+
+func RunPlan(pf *PlanFlags) error {
+	// Planning only reads state, hence always dry-run to be on the safe side
+	ctx := util.NewContext(true, pf.RootDir)
+	cfg, err := loadConfig(ctx, pf.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	cloudP, err := providers.CloudProviders().NewCloudProvider(ctx, &cfg.CloudProvider)
+	if err != nil {
+		return err
+	}
+
+	dnsP, err := providers.DNSProviders().NewDNSProvider(ctx, &cfg.DNSProvider, cfg.RootDomain)
+	if err != nil {
+		return err
+	}
+
+	p, err := plan.Compute(ctx, cfg, cloudP, dnsP)
+	if err != nil {
+		return err
+	}
+	return plan.Write(os.Stdout, p, plan.Format(pf.Format))
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/providers"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type ReapFlags struct {
+	*RootFlags
+
+	Force bool
+
+	// If CloudProvider.Name is set, the providers are configured from these flags instead of
+	// from the config file
+	CloudProvider config.Provider
+	DNSProvider   config.Provider
+	RootDomain    string
+}
+
+// NewReapCommand returns the "reap" command
+func NewReapCommand(rf *RootFlags) *cobra.Command {
+	rpf := &ReapFlags{
+		RootFlags: rf,
+	}
+	cmd := &cobra.Command{
+		Use:   "reap",
+		Short: "Delete the expired clusters of all workshops, and their DNS records",
+		Long: `Delete the clusters of all workshops in the cloud provider account that have expired,
+as set by the ttl or expiresAt fields of their config. The load balancers and volumes of the
+clusters are deleted too, and so are their DNS records if a DNS provider and root domain are
+given. DNS records are only deleted for the clusters of the workshop in the config file, or,
+without it, for the clusters created under the given root domain.
+
+The providers are configured either from the config file, or, if it's not around, from the
+flags. This allows running reap regularly, e.g. from cron or a CronJob, with --dry-run=false.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunReap(rpf); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	addReapFlags(cmd.Flags(), rpf)
+	return cmd
+}
+
+func addReapFlags(fs *pflag.FlagSet, rpf *ReapFlags) {
+	fs.BoolVar(&rpf.Force, "force", rpf.Force, "Delete all DNS records under the cluster domains, also those without an external-dns ownership record")
+	fs.StringVar(&rpf.CloudProvider.Name, "cloud-provider", rpf.CloudProvider.Name, "Use this cloud provider instead of the one in the config file")
+	fs.StringVar(&rpf.CloudProvider.ServiceAccountPath, "cloud-service-account", rpf.CloudProvider.ServiceAccountPath, "Path to the service account of the cloud provider given with --cloud-provider")
+	fs.StringVar(&rpf.DNSProvider.Name, "dns-provider", rpf.DNSProvider.Name, "Use this DNS provider together with --cloud-provider. If unset, no DNS records are deleted")
+	fs.StringVar(&rpf.DNSProvider.ServiceAccountPath, "dns-service-account", rpf.DNSProvider.ServiceAccountPath, "Path to the service account of the DNS provider given with --dns-provider")
+	fs.StringVar(&rpf.RootDomain, "root-domain", rpf.RootDomain, "The root domain the DNS records of the clusters are under, required with --dns-provider")
+}
+
+func RunReap(rpf *ReapFlags) error {
+	ctx := util.NewContext(rpf.DryRun, rpf.RootDir)
+	ctx = util.WithForce(ctx, rpf.Force)
+
+	cloudP, dnsP, cfg, err := reapProviders(ctx, rpf)
+	if err != nil {
+		return err
+	}
+
+	// List the clusters of all workshops
+	clusters, err := cloudP.ListClusters(ctx, "")
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	expired := []*provider.Cluster{}
+	for _, c := range clusters {
+		if c.Spec.ExpiresAt != nil && c.Spec.ExpiresAt.Before(now) {
+			expired = append(expired, c)
+		}
+	}
+	if len(expired) == 0 {
+		log.Info("There are no expired clusters")
+		return nil
+	}
+
+	errs := config.ClusterErrors{}
+	for _, c := range expired {
+		log.Infof("Cluster %s expired at %s", c.Name(), c.Spec.ExpiresAt.Format(time.RFC3339))
+		clusterDNSP := dnsP
+		if dnsP != nil && !recordsUnderRootDomain(c, cfg, rpf.RootDomain) {
+			log.Warnf("Not deleting the DNS records of cluster %s, as they aren't under the root domain of the DNS provider", c.Name())
+			clusterDNSP = nil
+		}
+		if err := reapCluster(ctx, c.ClusterMeta, cloudP, clusterDNSP); err != nil {
+			log.Errorf("Reaping cluster %s failed: %v", c.Name(), err)
+			errs = append(errs, &config.ClusterError{Cluster: c.Index, Err: fmt.Errorf("%s: %w", c.Name(), err)})
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+func reapCluster(ctx context.Context, m provider.ClusterMeta, cloudP provider.CloudProvider, dnsP provider.DNSProvider) error {
+	// Delete the Kubernetes cluster, including its load balancers and volumes
+	if err := cloudP.DeleteCluster(ctx, m); err != nil {
+		return err
+	}
+	if dnsP == nil {
+		return nil
+	}
+	// Delete the DNS records
+	unlock := util.Lock(ctx, util.LockDNS)
+	defer unlock()
+	return dnsP.CleanupRecords(ctx, m)
+}
+
+// recordsUnderRootDomain tells whether the DNS records of the cluster are under the root domain
+// of the DNS provider. The records are found by the cluster number only, and the external-dns
+// owner is the same for all workshops, hence the records of another workshop's cluster with the
+// same number would be deleted otherwise. With a config, only the clusters of its workshop are
+// under its root domain; without, the root domain the cluster was stamped with must match.
+func recordsUnderRootDomain(c *provider.Cluster, cfg *config.Config, rootDomain string) bool {
+	if cfg != nil {
+		return c.NamePrefix == cfg.Name
+	}
+	return c.Spec.RootDomain == provider.FormatRootDomain(rootDomain)
+}
+
+// reapProviders creates the providers from the flags if --cloud-provider is set, otherwise from
+// the config file, which is then returned too. The DNS provider is nil if none is configured
+// through the flags.
+func reapProviders(ctx context.Context, rpf *ReapFlags) (provider.CloudProvider, provider.DNSProvider, *config.Config, error) {
+	if rpf.CloudProvider.Name == "" {
+		cfg, err := loadConfig(ctx, rpf.ConfigPath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("couldn't load the config, use --cloud-provider to reap without it: %w", err)
+		}
+		cloudP, err := providers.CloudProviders().NewCloudProvider(ctx, &cfg.CloudProvider)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		dnsP, err := providers.DNSProviders().NewDNSProvider(ctx, &cfg.DNSProvider, cfg.RootDomain)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return cloudP, dnsP, cfg, nil
+	}
+
+	if err := rpf.CloudProvider.LoadServiceAccount(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+	cloudP, err := providers.CloudProviders().NewCloudProvider(ctx, &rpf.CloudProvider)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if rpf.DNSProvider.Name == "" {
+		log.Warn("No DNS provider given, hence the DNS records of the expired clusters are left behind")
+		return cloudP, nil, nil, nil
+	}
+	if rpf.RootDomain == "" {
+		return nil, nil, nil, fmt.Errorf("--root-domain is required with --dns-provider")
+	}
+	if err := rpf.DNSProvider.LoadServiceAccount(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+	dnsP, err := providers.DNSProviders().NewDNSProvider(ctx, &rpf.DNSProvider, rpf.RootDomain)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cloudP, dnsP, nil, nil
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"github.com/cloud-native-nordics/workshopctl/pkg/apply"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type ResumeFlags struct {
+	*RootFlags
+
+	Clusters ClustersFlag
+}
+
+// NewResumeCommand returns the "resume" command
+func NewResumeCommand(rf *RootFlags) *cobra.Command {
+	rsf := &ResumeFlags{
+		RootFlags: rf,
+	}
+	cmd := &cobra.Command{
+		Use:   "resume",
+		Short: "Scale the nodes of hibernated clusters back up",
+		Long: `Scale the node groups of hibernated clusters back up to the instances in the config,
+and wait for the clusters to be healthy again, like at the end of apply.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunResume(rsf); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	addResumeFlags(cmd.Flags(), rsf)
+	return cmd
+}
+
+func addResumeFlags(fs *pflag.FlagSet, rsf *ResumeFlags) {
+	AddClustersFlag(fs, &rsf.Clusters)
+}
+
+func RunResume(rsf *ResumeFlags) error {
+	ctx := util.NewContext(rsf.DryRun, rsf.RootDir)
+	ctx = util.WithFailFast(ctx, rsf.FailFast)
+	cfg, err := loadConfig(ctx, rsf.ConfigPath)
+	if err != nil {
+		return err
+	}
+	clusters, err := rsf.Clusters.Numbers(cfg)
+	if err != nil {
+		return err
+	}
+	return apply.Resume(ctx, cfg, clusters)
+}
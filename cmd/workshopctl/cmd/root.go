@@ -16,6 +16,7 @@ type RootFlags struct {
 	ConfigPath string
 	RootDir    string
 	DryRun     bool
+	FailFast   bool
 }
 
 // NewWorkshopCtlCommand returns the root command for workshopctl
@@ -39,9 +40,15 @@ func NewWorkshopCtlCommand() *cobra.Command {
 
 	root.AddCommand(NewInitCommand(rf))
 	root.AddCommand(NewGenCommand(rf))
+	root.AddCommand(NewPlanCommand(rf))
+	root.AddCommand(NewCostCommand(rf))
 	root.AddCommand(NewApplyCommand(rf))
 	root.AddCommand(NewKubectlCommand(rf))
+	root.AddCommand(NewHibernateCommand(rf))
+	root.AddCommand(NewResumeCommand(rf))
 	root.AddCommand(NewCleanupCommand(rf))
+	root.AddCommand(NewReapCommand(rf))
+	root.AddCommand(NewCredentialsCommand(rf))
 	root.AddCommand(versioncmd.NewCmdVersion(os.Stdout))
 	return root
 }
@@ -51,4 +58,5 @@ func addGlobalFlags(fs *pflag.FlagSet, rf *RootFlags) {
 	fs.StringVar(&rf.RootDir, "root-dir", rf.RootDir, "Where the workshopctl directory is. Must be a Git repo.")
 	fs.StringVar(&rf.ConfigPath, "config-path", rf.ConfigPath, "Where to find the config file")
 	fs.BoolVar(&rf.DryRun, "dry-run", rf.DryRun, "Whether to apply the selected operation, or just print what would happen (to dry-run)")
+	fs.BoolVar(&rf.FailFast, "fail-fast", rf.FailFast, "Cancel the operation for all clusters as soon as one of them fails")
 }
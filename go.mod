@@ -3,20 +3,25 @@ module github.com/cloud-native-nordics/workshopctl
 go 1.16
 
 require (
+	github.com/aws/aws-sdk-go v1.44.100
+	github.com/cloudflare/cloudflare-go v0.20.0
 	github.com/digitalocean/godo v1.48.0
 	github.com/fluxcd/go-git-providers v0.0.3
 	github.com/go-openapi/spec v0.19.8 // indirect
+	github.com/hetznercloud/hcloud-go v1.28.0
 	github.com/kr/text v0.2.0 // indirect
+	github.com/miekg/dns v1.1.50
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/otiai10/copy v1.2.0
 	github.com/sirupsen/logrus v1.7.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/cobra v1.1.1
 	github.com/spf13/pflag v1.0.5
-	github.com/stretchr/testify v1.6.1 // indirect
 	github.com/whilp/git-urls v1.0.0
-	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
-	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
+	golang.org/x/crypto v0.14.0
+	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43
+	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200605160147-a5ece683394c // indirect
 	k8s.io/apimachinery v0.19.3
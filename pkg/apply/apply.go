@@ -2,19 +2,24 @@ package apply
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/cloud-native-nordics/workshopctl/pkg/config"
 	"github.com/cloud-native-nordics/workshopctl/pkg/config/keyval"
 	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+	"github.com/cloud-native-nordics/workshopctl/pkg/cost"
 	"github.com/cloud-native-nordics/workshopctl/pkg/gotk"
 	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
 	"github.com/cloud-native-nordics/workshopctl/pkg/provider/providers"
 	"github.com/cloud-native-nordics/workshopctl/pkg/util"
 )
 
-func Apply(ctx context.Context, cfg *config.Config) error {
+// Apply provisions the given clusters and applies everything needed for the workshop
+func Apply(ctx context.Context, cfg *config.Config, clusters config.ClusterNumbers) error {
 	// TODO: Enforce that gen is up-to-date
 
 	cloudP, err := providers.CloudProviders().NewCloudProvider(ctx, &cfg.CloudProvider)
@@ -27,80 +32,259 @@ func Apply(ctx context.Context, cfg *config.Config) error {
 		return err
 	}
 
+	// Fail early if the Kubernetes version isn't available
+	version, err := resolveVersion(ctx, cfg, cloudP)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listClusters(ctx, cfg, cloudP)
+	if err != nil {
+		return err
+	}
+
+	// Only the clusters that don't exist yet add to the cost
+	toCreate := uint16(0)
+	for _, i := range clusters {
+		if existing[i] == nil {
+			toCreate++
+		}
+	}
+	if err := cost.CheckBudget(ctx, cfg, cloudP, toCreate); err != nil {
+		return err
+	}
+
 	// Make sure the domain zone is created before starting to reconcile the clusters
 	// Otherwise external-dns nor Traefik will work.
 	if err := dnsP.EnsureZone(ctx); err != nil {
 		return err
 	}
 
-	return config.ForCluster(ctx, cfg.Clusters, cfg, func(clusterCtx context.Context, clusterInfo *config.ClusterInfo) error {
-		return ApplyCluster(clusterCtx, clusterInfo, cloudP)
+	return config.ForCluster(ctx, clusters, cfg, func(clusterCtx context.Context, clusterInfo *config.ClusterInfo) error {
+		return ApplyCluster(clusterCtx, clusterInfo, existing[clusterInfo.Index], version, cloudP, dnsP)
 	})
 }
 
-func ApplyCluster(ctx context.Context, clusterInfo *config.ClusterInfo, p provider.CloudProvider) error {
+// ApplyCluster provisions the cluster with the given, exact Kubernetes version and applies everything
+// needed for the workshop. cluster is the existing cluster as listed by the provider, or nil if it
+// doesn't exist. Every phase records its completion in the workshopctl ConfigMap, and is skipped
+// when already done.
+func ApplyCluster(ctx context.Context, clusterInfo *config.ClusterInfo, cluster *provider.Cluster, version string, p provider.CloudProvider, dnsP provider.DNSProvider) error {
 	logger := util.Logger(ctx)
+	kubeconfigPath := clusterInfo.Index.KubeConfigPath()
 
-	// Add some kind of mark at the end of this procedure in the cluster to say that it's
-	// been successfully provisioned (maybe in the workshopctl ConfigMap?). With this feature
-	// it's possible at this stage to skip doing the same things over and over again => idempotent
+	markers, recordCreated, err := ensureCluster(ctx, clusterInfo, cluster, version, p)
+	if err != nil {
+		return err
+	}
 
-	kubeconfigPath := clusterInfo.Index.KubeConfigPath()
-	if !util.FileExists(kubeconfigPath) {
-		// TODO: Instead, make provisionCluster idempotent
-		logger.Info("Provisioning the Kubernetes cluster")
-		if err := provisionCluster(ctx, clusterInfo, p); err != nil {
+	if !markers.done(phaseNamespace, phaseDone) {
+		logger.Info("Applying workshopctl Namespace")
+		if _, err := kubectl(ctx, kubeconfigPath).
+			Create("namespace", "", constants.WorkshopctlNamespace, true, false).
+			Run(); err != nil {
+			return err
+		}
+		if err := markers.record(ctx, kubeconfigPath, phaseNamespace, phaseDone); err != nil {
 			return err
 		}
-	} else {
-		logger.Infof("Assuming cluster is already provisioned, as %q exists...", kubeconfigPath)
 	}
-
-	logger.Info("Applying workshopctl Namespace")
-	if _, err := kubectl(ctx, kubeconfigPath).
-		Create("namespace", "", constants.WorkshopctlNamespace, true, false).
-		Run(); err != nil {
-		return err
+	// The marker can only be recorded once the namespace exists
+	if recordCreated {
+		if err := markers.record(ctx, kubeconfigPath, phaseClusterCreated, phaseDone); err != nil {
+			return err
+		}
 	}
 
-	// Setup GitOps sync
-	if err := gotk.SetupGitOps(ctx, clusterInfo); err != nil {
-		return err
+	if !markers.done(phaseGitOps, phaseDone) {
+		if clusterInfo.Secrets.Enabled() {
+			// Flux needs the decryption key in place before it starts reconciling the encrypted Secret
+			if err := applySOPSKey(ctx, clusterInfo); err != nil {
+				return err
+			}
+		}
+
+		// Setup GitOps sync
+		if err := gotk.SetupGitOps(ctx, clusterInfo); err != nil {
+			return err
+		}
+		if err := markers.record(ctx, kubeconfigPath, phaseGitOps, phaseDone); err != nil {
+			return err
+		}
+	} else {
+		logger.Info("Skipping GitOps setup, it is already done")
 	}
 
 	localKubectl := func() *kubectlExecer {
 		return kubectl(ctx, kubeconfigPath).WithNS(constants.WorkshopctlNamespace)
 	}
 
-	paramFlags := []string{}
-	// Append secret parameters
-	parameters := keyval.FromClusterInfo(clusterInfo)
-	for k, v := range parameters.ToMap() {
-		paramFlags = append(paramFlags, fmt.Sprintf("--from-literal=%s=%s", k, v))
-	}
-
-	logger.Info("Applying workshopctl Secret")
-	if _, err := localKubectl().
-		Create("secret", "generic", constants.WorkshopctlSecret, true, true).
-		WithArgs(paramFlags...).
-		Run(); err != nil {
-		return err
+	// The digests of the applied content, which the wait covers
+	waitedFor := map[string]string{}
+	if clusterInfo.Secrets.Enabled() {
+		logger.Infof("Skipping the workshopctl Secret, Flux applies it from %s", constants.EncryptedSecretFile)
+	} else {
+		// Append secret parameters
+		parameters := keyval.FromClusterInfo(clusterInfo).ToMap()
+		secretDigest := digest(parameters)
+		waitedFor[string(phaseSecret)] = secretDigest
+		if !markers.done(phaseSecret, secretDigest) {
+			paramFlags := []string{}
+			for k, v := range parameters {
+				paramFlags = append(paramFlags, fmt.Sprintf("--from-literal=%s=%s", k, v))
+			}
+
+			logger.Info("Applying workshopctl Secret")
+			if _, err := localKubectl().
+				Create("secret", "generic", constants.WorkshopctlSecret, true, true).
+				WithArgs(paramFlags...).
+				Run(); err != nil {
+				return err
+			}
+			if err := markers.record(ctx, kubeconfigPath, phaseSecret, secretDigest); err != nil {
+				return err
+			}
+		} else {
+			logger.Info("Skipping the workshopctl Secret, it is up-to-date")
+		}
 	}
 
 	requiredAddons := []string{"core-workshop-infra"}
+	addons := map[string]string{}
 	for _, addon := range requiredAddons {
 		addonPath := fmt.Sprintf("%s/%s/%s.yaml", constants.ClustersDir, clusterInfo.Index, addon)
-		logger.Infof("Applying addon %s", addonPath)
-		if _, err := localKubectl().WithArgs("apply").WithFile(addonPath).Run(); err != nil {
+		b, err := ioutil.ReadFile(util.JoinPaths(ctx, addonPath))
+		if err != nil {
+			return err
+		}
+		addons[addonPath] = string(b)
+	}
+	addonsDigest := digest(addons)
+	waitedFor[string(phaseAddons)] = addonsDigest
+	if !markers.done(phaseAddons, addonsDigest) {
+		for _, addon := range requiredAddons {
+			addonPath := fmt.Sprintf("%s/%s/%s.yaml", constants.ClustersDir, clusterInfo.Index, addon)
+			logger.Infof("Applying addon %s", addonPath)
+			if _, err := localKubectl().WithArgs("apply").WithFile(addonPath).Run(); err != nil {
+				return err
+			}
+		}
+		if err := markers.record(ctx, kubeconfigPath, phaseAddons, addonsDigest); err != nil {
 			return err
 		}
+	} else {
+		logger.Info("Skipping the addons, they are up-to-date")
 	}
 
+	// Wait again when the Secret or the addons changed, as the changed workloads have to come up
+	waitedDigest := digest(waitedFor)
+	if markers.done(phaseWaited, waitedDigest) {
+		logger.Info("Skipping waiting for the cluster, it has been healthy with the same Secret and addons before")
+		return nil
+	}
 	// Wait for the cluster to be healthy
-	return NewWaiter(ctx, clusterInfo).WaitForAll()
+	if err := NewWaiter(ctx, clusterInfo, dnsP).WaitForAll(); err != nil {
+		return err
+	}
+	return markers.record(ctx, kubeconfigPath, phaseWaited, waitedDigest)
+}
+
+// ensureCluster provisions the cluster unless it exists already, and makes sure its kubeconfig is
+// on disk. It returns the phases that are done, and whether the creation of the cluster still has
+// to be recorded.
+func ensureCluster(ctx context.Context, clusterInfo *config.ClusterInfo, cluster *provider.Cluster, version string, p provider.CloudProvider) (phaseMarkers, bool, error) {
+	logger := util.Logger(ctx)
+
+	markers, err := ensureKubeconfig(ctx, clusterInfo, cluster, p)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case markers.done(phaseClusterCreated, phaseDone):
+		logger.Info("Skipping provisioning, the cluster is already provisioned")
+		return markers, false, nil
+	case cluster != nil:
+		// An earlier run created the cluster but failed before recording it, re-use the cluster
+		// with the recovered KubeConfig
+		logger.Info("Skipping provisioning, the cluster exists already")
+		return markers, true, nil
+	default:
+		logger.Info("Provisioning the Kubernetes cluster")
+		if err := provisionCluster(ctx, clusterInfo, version, p); err != nil {
+			return nil, false, err
+		}
+		return markers, true, nil
+	}
+}
+
+// listClusters lists the existing clusters of the workshop once, by their number
+func listClusters(ctx context.Context, cfg *config.Config, p provider.CloudProvider) (map[config.ClusterNumber]*provider.Cluster, error) {
+	clusters, err := p.ListClusters(ctx, cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[config.ClusterNumber]*provider.Cluster, len(clusters))
+	for _, c := range clusters {
+		existing[c.Index] = c
+	}
+	return existing, nil
+}
+
+// ensureKubeconfig makes sure the kubeconfig on disk belongs to the existing cluster, and returns
+// the phases that are done. If the cluster is nil, i.e. doesn't exist, no phases are done. If the
+// cluster exists but the kubeconfig is missing, it is fetched from the provider.
+func ensureKubeconfig(ctx context.Context, clusterInfo *config.ClusterInfo, cluster *provider.Cluster, p provider.CloudProvider) (phaseMarkers, error) {
+	logger := util.Logger(ctx)
+	kubeconfigPath := clusterInfo.Index.KubeConfigPath()
+	m := provider.ClusterMeta{
+		NamePrefix: clusterInfo.Name,
+		Index:      clusterInfo.Index,
+	}
+
+	if cluster == nil {
+		if util.FileExists(kubeconfigPath) {
+			logger.Warnf("Cluster %s doesn't exist anymore, ignoring %q", m.Name(), kubeconfigPath)
+		}
+		return phaseMarkers{}, nil
+	}
+
+	if !util.FileExists(kubeconfigPath) {
+		logger.Infof("Cluster %s exists, fetching its KubeConfig as %q is missing", m.Name(), kubeconfigPath)
+		kubeconfig, err := p.GetKubeconfig(ctx, m)
+		if errors.Is(err, provider.ErrKubeconfigUnrecoverable) {
+			return nil, fmt.Errorf("%w. Restore %q from a backup, or delete the cluster with \"workshopctl cleanup --clusters %s\" and apply again", err, kubeconfigPath, clusterInfo.Index)
+		} else if err != nil {
+			return nil, err
+		}
+		if err := util.WriteFile(ctx, kubeconfigPath, kubeconfig); err != nil {
+			return nil, err
+		}
+	}
+	return readPhaseMarkers(ctx, kubeconfigPath)
+}
+
+func applySOPSKey(ctx context.Context, clusterInfo *config.ClusterInfo) error {
+	logger := util.Logger(ctx)
+	kubeconfigPath := clusterInfo.Index.KubeConfigPath()
+
+	logger.Info("Applying flux-system Namespace")
+	if _, err := kubectl(ctx, kubeconfigPath).
+		Create("namespace", "", constants.FluxNamespace, true, false).
+		Run(); err != nil {
+		return err
+	}
+
+	logger.Info("Applying SOPS decryption key Secret")
+	keyPath := util.JoinPaths(ctx, clusterInfo.Secrets.DecryptionKeyPath)
+	_, err := kubectl(ctx, kubeconfigPath).WithNS(constants.FluxNamespace).
+		Create("secret", "generic", constants.SOPSSecret, true, true).
+		WithArgs(fmt.Sprintf("--from-file=%s=%s", clusterInfo.Secrets.DecryptionKeyName(), keyPath)).
+		Run()
+	return err
 }
 
-func provisionCluster(ctx context.Context, clusterInfo *config.ClusterInfo, p provider.CloudProvider) error {
+func provisionCluster(ctx context.Context, clusterInfo *config.ClusterInfo, version string, p provider.CloudProvider) error {
 	logger := util.Logger(ctx)
 
 	logger.Infof("Provisioning cluster %s...", clusterInfo.Index)
@@ -108,8 +292,10 @@ func provisionCluster(ctx context.Context, clusterInfo *config.ClusterInfo, p pr
 		Index:      clusterInfo.Index,
 		NamePrefix: clusterInfo.Name,
 	}, provider.ClusterSpec{
-		Version:    "latest",
+		Version:    version,
 		NodeGroups: clusterInfo.NodeGroups,
+		ExpiresAt:  clusterInfo.ClusterExpiry(time.Now()),
+		RootDomain: provider.FormatRootDomain(clusterInfo.RootDomain),
 	})
 	if err != nil {
 		return fmt.Errorf("encountered an error while creating clusters: %v", err)
@@ -0,0 +1,140 @@
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/byo"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+// fakeKubectl logs its arguments to kubectl.log. It fails to reach the cluster when the file
+// "unreachable" exists, and otherwise succeeds without output, i.e. no phases are done.
+const fakeKubectl = `#!/bin/sh
+echo "$@" >> kubectl.log
+case "$*" in
+*/readyz*) [ ! -e unreachable ] || { echo "connection refused" >&2; exit 1; } ;;
+esac
+`
+
+const byoKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: venue
+  cluster:
+    server: https://10.0.0.1:6443
+`
+
+// setupRootDir creates a root directory with a byo kubeconfig and a fake kubectl on the PATH, and
+// changes into it, as apply works relative to the root directory
+func setupRootDir(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"bin/kubectl":                  fakeKubectl,
+		"venue/cluster-01.yaml":        byoKubeconfig,
+		"clusters/01/placeholder.yaml": "",
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+path)
+	t.Cleanup(func() {
+		os.Setenv("PATH", path)
+		_ = os.Chdir(wd)
+	})
+	return dir
+}
+
+func kubectlCalls(t *testing.T) string {
+	b, err := ioutil.ReadFile("kubectl.log")
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestEnsureClusterBYO(t *testing.T) {
+	dir := setupRootDir(t)
+	ctx := util.NewContext(false, dir)
+	cfg := &config.Config{
+		Name:     "workshop",
+		Clusters: 1,
+		CloudProvider: config.Provider{
+			Name:             "byo",
+			ProviderSpecific: map[string]string{byo.KubeconfigsKey: "venue/cluster-01.yaml"},
+		},
+	}
+	clusterInfo := &config.ClusterInfo{Config: cfg, Index: 1}
+	p, err := byo.NewBYOCloudProvider(ctx, &cfg.CloudProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cluster hasn't been taken over yet, hence apply has to check that it is reachable
+	existing, err := listClusters(ctx, cfg, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existing) != 0 {
+		t.Fatalf("expected no existing clusters before the first apply, got %v", existing)
+	}
+
+	if err := ioutil.WriteFile("unreachable", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ensureCluster(ctx, clusterInfo, existing[1], "", p); err == nil || !strings.Contains(err.Error(), "isn't reachable") {
+		t.Fatalf("expected an unreachable cluster to fail, got %v", err)
+	}
+	if util.FileExists(clusterInfo.Index.KubeConfigPath()) {
+		t.Error("expected the kubeconfig of an unreachable cluster not to be copied")
+	}
+
+	if err := os.Remove("unreachable"); err != nil {
+		t.Fatal(err)
+	}
+	_, recordCreated, err := ensureCluster(ctx, clusterInfo, existing[1], "", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recordCreated {
+		t.Error("expected the creation of the cluster to be recorded")
+	}
+	if calls := kubectlCalls(t); !strings.Contains(calls, "--kubeconfig "+filepath.Join(dir, "venue/cluster-01.yaml")+" get --raw /readyz") {
+		t.Errorf("expected the reachability of the cluster to be checked, got kubectl calls:\n%s", calls)
+	}
+	b, err := ioutil.ReadFile(clusterInfo.Index.KubeConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != byoKubeconfig {
+		t.Errorf("expected the kubeconfig to be copied, got:\n%s", b)
+	}
+
+	// Once taken over, the cluster is reported as existing
+	existing, err = listClusters(ctx, cfg, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existing) != 1 || existing[1] == nil {
+		t.Errorf("expected cluster 01 to exist after apply, got %v", existing)
+	}
+}
@@ -0,0 +1,88 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/providers"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+// Hibernate scales the nodes of the given clusters down, e.g. between workshop days. The clusters,
+// their DNS records and credentials are kept.
+func Hibernate(ctx context.Context, cfg *config.Config, clusters config.ClusterNumbers) error {
+	_, hibernator, err := newHibernator(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	return config.ForCluster(ctx, clusters, cfg, func(clusterCtx context.Context, clusterInfo *config.ClusterInfo) error {
+		util.Logger(clusterCtx).Info("Hibernating the cluster")
+		return hibernator.Hibernate(clusterCtx, provider.ClusterMeta{
+			NamePrefix: clusterInfo.Name,
+			Index:      clusterInfo.Index,
+		})
+	})
+}
+
+// Resume scales the nodes of the given hibernated clusters back up to the configured node groups,
+// and waits for the clusters to be healthy again
+func Resume(ctx context.Context, cfg *config.Config, clusters config.ClusterNumbers) error {
+	cloudP, hibernator, err := newHibernator(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	dnsP, err := providers.DNSProviders().NewDNSProvider(ctx, &cfg.DNSProvider, cfg.RootDomain)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listClusters(ctx, cfg, cloudP)
+	if err != nil {
+		return err
+	}
+
+	return config.ForCluster(ctx, clusters, cfg, func(clusterCtx context.Context, clusterInfo *config.ClusterInfo) error {
+		return resumeCluster(clusterCtx, clusterInfo, existing[clusterInfo.Index], cloudP, hibernator, dnsP)
+	})
+}
+
+// resumeCluster scales the nodes of the cluster back up, and waits for the cluster to be healthy
+func resumeCluster(ctx context.Context, clusterInfo *config.ClusterInfo, cluster *provider.Cluster, cloudP provider.CloudProvider, hibernator provider.Hibernator, dnsP provider.DNSProvider) error {
+	logger := util.Logger(ctx)
+	m := provider.ClusterMeta{
+		NamePrefix: clusterInfo.Name,
+		Index:      clusterInfo.Index,
+	}
+
+	// The waiter needs the KubeConfig
+	if _, err := ensureKubeconfig(ctx, clusterInfo, cluster, cloudP); err != nil {
+		return err
+	}
+
+	logger.Info("Resuming the cluster")
+	if err := hibernator.Resume(ctx, m, provider.ClusterSpec{NodeGroups: clusterInfo.NodeGroups}); err != nil {
+		return err
+	}
+	if util.IsDryRun(ctx) {
+		logger.Info("Would wait for the cluster to be healthy")
+		return nil
+	}
+	// The workloads are rescheduled onto the new nodes, wait for them like after apply
+	return NewWaiter(ctx, clusterInfo, dnsP).WaitForAll()
+}
+
+func newHibernator(ctx context.Context, cfg *config.Config) (provider.CloudProvider, provider.Hibernator, error) {
+	cloudP, err := providers.CloudProviders().NewCloudProvider(ctx, &cfg.CloudProvider)
+	if err != nil {
+		return nil, nil, err
+	}
+	hibernator, ok := cloudP.(provider.Hibernator)
+	if !ok {
+		return nil, nil, fmt.Errorf("cloud provider %q can't hibernate clusters", cfg.CloudProvider.Name)
+	}
+	return cloudP, hibernator, nil
+}
@@ -0,0 +1,100 @@
+package apply
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+)
+
+// phase is a step of applying a cluster. When a phase is done, a marker is recorded in the
+// workshopctl ConfigMap, so that re-running apply can skip it.
+type phase string
+
+const (
+	phaseClusterCreated phase = "cluster-created"
+	phaseNamespace      phase = "namespace"
+	phaseGitOps         phase = "gitops"
+	phaseSecret         phase = "secret"
+	phaseAddons         phase = "addons"
+	phaseWaited         phase = "waited"
+)
+
+// phaseDone is the marker value of phases that don't depend on any input
+const phaseDone = "done"
+
+// phaseMarkers maps a phase to its marker value. For phases that apply content, like the
+// Secret or the addons, the value is a digest of that content. Hence, the phase is run again
+// when the content changes.
+type phaseMarkers map[phase]string
+
+func (pm phaseMarkers) done(p phase, value string) bool {
+	return pm[p] == value
+}
+
+// readPhaseMarkers reads the phase markers from the workshopctl ConfigMap. If the ConfigMap
+// doesn't exist, no phases are done.
+func readPhaseMarkers(ctx context.Context, kubeconfigPath string) (phaseMarkers, error) {
+	out, err := kubectl(ctx, kubeconfigPath).WithNS(constants.WorkshopctlNamespace).
+		WithArgs("get", "configmap", constants.WorkshopctlConfigMap, "-o", "json").
+		IgnoreErrors("NotFound").
+		Run()
+	if err != nil {
+		return nil, err
+	}
+	pm := phaseMarkers{}
+	if strings.Contains(out, "NotFound") || len(out) == 0 {
+		return pm, nil
+	}
+	cm := struct {
+		Data map[phase]string `json:"data"`
+	}{}
+	if err := json.Unmarshal([]byte(out), &cm); err != nil {
+		return nil, fmt.Errorf("couldn't parse the %s ConfigMap: %w", constants.WorkshopctlConfigMap, err)
+	}
+	for p, v := range cm.Data {
+		pm[p] = v
+	}
+	return pm, nil
+}
+
+// record marks the phase as done, both in-memory and in the workshopctl ConfigMap
+func (pm phaseMarkers) record(ctx context.Context, kubeconfigPath string, p phase, value string) error {
+	if _, err := kubectl(ctx, kubeconfigPath).WithNS(constants.WorkshopctlNamespace).
+		Create("configmap", "", constants.WorkshopctlConfigMap, true, false).
+		Run(); err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]map[phase]string{
+		"data": {p: value},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := kubectl(ctx, kubeconfigPath).WithNS(constants.WorkshopctlNamespace).
+		WithArgs("patch", "configmap", constants.WorkshopctlConfigMap, "--type=merge", "-p", string(patch)).
+		Run(); err != nil {
+		return err
+	}
+	pm[p] = value
+	return nil
+}
+
+// digest returns a stable hash of the given key-value pairs
+func digest(kv map[string]string) string {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, kv[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
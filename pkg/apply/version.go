@@ -0,0 +1,62 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+// recordedVersion is the content of the kubernetes-version.json file
+type recordedVersion struct {
+	CloudProvider string `json:"cloudProvider"`
+	Requested     string `json:"requested"`
+	Resolved      string `json:"resolved"`
+}
+
+// resolveVersion returns the exact Kubernetes version to create clusters with. The version is
+// resolved once and then recorded, so that clusters created later run the same version, even if
+// the provider has released a newer one in the meantime. It is only resolved again when the
+// requested version or the cloud provider changes.
+func resolveVersion(ctx context.Context, cfg *config.Config, p provider.CloudProvider) (string, error) {
+	logger := util.Logger(ctx)
+	versionFile := util.JoinPaths(ctx, constants.KubernetesVersionFile)
+
+	recorded := recordedVersion{}
+	b, err := ioutil.ReadFile(versionFile)
+	if err == nil {
+		if err := json.Unmarshal(b, &recorded); err != nil {
+			return "", fmt.Errorf("couldn't parse %q: %w", versionFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	if recorded.CloudProvider == cfg.CloudProvider.Name && recorded.Requested == cfg.KubernetesVersion {
+		logger.Debugf("Using Kubernetes version %s, as recorded in %q", recorded.Resolved, versionFile)
+		return recorded.Resolved, nil
+	}
+
+	resolved, err := p.ResolveVersion(ctx, cfg.KubernetesVersion)
+	if err != nil {
+		return "", err
+	}
+	logger.Infof("Kubernetes version %q resolved to %s, recording it in %q", cfg.KubernetesVersion, resolved, versionFile)
+	b, err = json.MarshalIndent(recordedVersion{
+		CloudProvider: cfg.CloudProvider.Name,
+		Requested:     cfg.KubernetesVersion,
+		Resolved:      resolved,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := util.WriteFile(ctx, versionFile, append(b, '\n')); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/cloud-native-nordics/workshopctl/pkg/config"
 	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
 	"github.com/cloud-native-nordics/workshopctl/pkg/util"
 	"github.com/sirupsen/logrus"
 )
@@ -16,10 +17,11 @@ type Waiter struct {
 	*config.ClusterInfo
 	ctx    context.Context
 	logger *logrus.Entry
+	dnsP   provider.DNSProvider
 }
 
-func NewWaiter(ctx context.Context, info *config.ClusterInfo) *Waiter {
-	return &Waiter{info, ctx, util.Logger(ctx)}
+func NewWaiter(ctx context.Context, info *config.ClusterInfo, dnsP provider.DNSProvider) *Waiter {
+	return &Waiter{info, ctx, util.Logger(ctx), dnsP}
 }
 
 func (w *Waiter) kubectl() *kubectlExecer {
@@ -76,6 +78,17 @@ func (w *Waiter) WaitForDNSPropagation() error {
 		return err
 	}
 
+	// If the DNS provider doesn't rely on external-dns, create the records now that the IP is known.
+	// These records are local, hence there's no need to wait for propagation.
+	if rp, ok := w.dnsP.(provider.RecordsProvider); ok {
+		unlock := util.Lock(w.ctx, util.LockDNS)
+		defer unlock()
+		return rp.EnsureRecords(w.ctx, provider.ClusterMeta{
+			NamePrefix: w.Name,
+			Index:      w.Index,
+		}, ip)
+	}
+
 	return util.Poll(w.ctx, nil, func() (bool, error) {
 		prefixes := []string{""} // "dashboard"
 		for _, prefix := range prefixes {
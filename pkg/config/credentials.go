@@ -0,0 +1,105 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"golang.org/x/crypto/bcrypt"
+	"sigs.k8s.io/yaml"
+)
+
+// passwordBytes is the amount of random bytes used for generated passwords
+const passwordBytes = 4
+
+// Credentials are the login credentials for one cluster. They are persisted in
+// ./clusters/<cluster>/.credentials so that gen and apply always agree on the same
+// password and bcrypt hash. In order to rotate the credentials for a cluster,
+// delete its credentials file and re-run gen and apply.
+type Credentials struct {
+	Password string `json:"password"`
+	// BasicAuthHash is the bcrypt hash of Password
+	BasicAuthHash string `json:"basicAuthHash"`
+}
+
+func (c *Credentials) matches(password string) bool {
+	if c.Password != password || len(c.BasicAuthHash) == 0 {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.BasicAuthHash), []byte(password)) == nil
+}
+
+// loadCredentials reads the credentials for the given cluster from disk. If the context allows
+// generating credentials, new ones are created if they don't exist or are out of date, and written
+// to disk immediately unless dry-running. Otherwise, the credentials must exist.
+func loadCredentials(ctx context.Context, cfg *Config, i ClusterNumber) (*Credentials, error) {
+	logger := util.Logger(ctx)
+	credsPath := util.JoinPaths(ctx, i.CredentialsPath())
+
+	stored := &Credentials{}
+	exists := util.FileExists(credsPath)
+	if exists {
+		if err := util.ReadYAMLFile(credsPath, stored); err != nil {
+			return nil, fmt.Errorf("couldn't read credentials file %q: %w", credsPath, err)
+		}
+	}
+	if !util.IsGenerateCredentials(ctx) {
+		if !exists {
+			return nil, fmt.Errorf("credentials file %q doesn't exist, run gen first", credsPath)
+		}
+		return stored, nil
+	}
+
+	password := cfg.ClusterLogin.CommonPassword
+	if cfg.ClusterLogin.UniquePasswords {
+		// Warn about possible misconfigurations
+		if len(cfg.ClusterLogin.CommonPassword) != 0 {
+			logger.Warnf("You have specified both .ClusterLogin.UniquePasswords and .ClusterLogin.CommonPassword. UniquePasswords has higher priority and hence CommonPassword is ignored.")
+		}
+		// Re-use the stored password if there is one, otherwise generate a new one
+		password = stored.Password
+		if len(password) == 0 {
+			var err error
+			password, err = util.RandomSHA(passwordBytes)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// If the stored credentials are up-to-date, we're done
+	if stored.matches(password) {
+		logger.Debugf("Using stored credentials from %q", credsPath)
+		return stored, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	creds := &Credentials{
+		Password:      password,
+		BasicAuthHash: string(hash),
+	}
+	if util.IsDryRun(ctx) {
+		logger.Infof("Would write new credentials to %q", credsPath)
+		return creds, nil
+	}
+	logger.Infof("Writing new credentials to %q", credsPath)
+	return creds, writeCredentials(credsPath, creds)
+}
+
+// writeCredentials writes the credentials file with restricted permissions
+func writeCredentials(credsPath string, creds *Credentials) error {
+	b, err := yaml.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(credsPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(credsPath, b, 0600)
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultConcurrency is how many clusters are operated on in parallel by default
+const DefaultConcurrency = 10
+
+// summaryWriter is where ForCluster writes its summary table. Stdout is reserved for the output
+// of the commands, e.g. the handouts of "workshopctl credentials".
+var summaryWriter io.Writer = os.Stderr
+
+// ClusterError is the error of the operation on one cluster
+type ClusterError struct {
+	Cluster ClusterNumber
+	Err     error
+}
+
+func (e *ClusterError) Error() string {
+	return fmt.Sprintf("cluster %s: %v", e.Cluster, e.Err)
+}
+
+func (e *ClusterError) Unwrap() error {
+	return e.Err
+}
+
+// ClusterErrors is returned by ForCluster if the operation failed for any cluster
+type ClusterErrors []*ClusterError
+
+func (es ClusterErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Sprintf("the operation failed for %d cluster(s):\n%s", len(es), strings.Join(msgs, "\n"))
+}
+
+type clusterStatus string
+
+const (
+	statusSucceeded clusterStatus = "succeeded"
+	statusFailed    clusterStatus = "failed"
+	// statusCancelled means the operation was never started, or aborted due to fail-fast
+	statusCancelled clusterStatus = "cancelled"
+)
+
+type clusterResult struct {
+	cluster  ClusterNumber
+	status   clusterStatus
+	duration time.Duration
+	err      error
+}
+
+// ForCluster runs fn for the given clusters in parallel, but at most cfg.Concurrency at a time.
+// The errors of all clusters are collected into ClusterErrors. If fail-fast is enabled in the
+// context, the context passed to fn is cancelled as soon as one cluster fails, and the clusters
+// that haven't started yet are skipped. At the end, a summary table is printed.
+func ForCluster(ctx context.Context, clusters ClusterNumbers, cfg *Config, fn func(context.Context, *ClusterInfo) error) error {
+	logrus.Debugf("Running function for clusters %s, %d at a time", clusters, cfg.Concurrency)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	failFast := util.IsFailFast(ctx)
+
+	concurrency := int(cfg.Concurrency)
+	if concurrency == 0 {
+		concurrency = DefaultConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(clusters))
+	results := make([]*clusterResult, len(clusters))
+
+	// locks shared by cluster threads when they need to coordinate
+	ctx = util.WithLocks(ctx)
+	for i, n := range clusters {
+		go func(i int, j ClusterNumber) {
+			defer wg.Done()
+			result := &clusterResult{cluster: j, status: statusCancelled}
+			results[i] = result
+
+			// Wait for a free slot, unless the operation was cancelled in the meantime
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			clusterCtx := util.WithClusterNumber(ctx, uint16(j))
+			logger := util.Logger(clusterCtx)
+			logger.Tracef("ForCluster goroutine starting...")
+			defer logger.Tracef("ForCluster goroutine is done")
+
+			start := time.Now()
+			clusterInfo, err := NewClusterInfo(clusterCtx, cfg, j)
+			if err == nil {
+				err = fn(clusterCtx, clusterInfo)
+			}
+			result.duration = time.Since(start).Round(time.Second)
+			switch {
+			case err == nil:
+				result.status = statusSucceeded
+			case errors.Is(err, context.Canceled) || ctx.Err() != nil:
+				// Another cluster failed first, and this one was aborted because of that
+				result.err = err
+			default:
+				logger.Error(err)
+				result.status = statusFailed
+				result.err = err
+				if failFast {
+					logger.Warn("Cancelling the operation for all other clusters, as fail-fast is enabled")
+					cancel()
+				}
+			}
+		}(i, n)
+	}
+	wg.Wait()
+
+	writeSummary(summaryWriter, results)
+
+	var errs ClusterErrors
+	for _, result := range results {
+		if result.status == statusFailed {
+			errs = append(errs, &ClusterError{Cluster: result.cluster, Err: result.err})
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	// If the parent context was cancelled, there might be no failed clusters, but not all succeeded
+	for _, result := range results {
+		if result.status == statusCancelled {
+			return fmt.Errorf("the operation was cancelled for cluster %s", result.cluster)
+		}
+	}
+	return nil
+}
+
+func writeSummary(w io.Writer, results []*clusterResult) {
+	// A table for one cluster is just noise
+	if len(results) <= 1 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tSTATUS\tDURATION\tERROR")
+	for _, r := range results {
+		errStr := ""
+		if r.status == statusFailed {
+			// Only show the first line, the full error is logged and returned
+			errStr = strings.SplitN(r.err.Error(), "\n", 2)[0]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.cluster, r.status, r.duration, errStr)
+	}
+	tw.Flush()
+}
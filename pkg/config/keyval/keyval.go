@@ -12,6 +12,8 @@ var externalDNSMap = map[string]string{
 	"scaleway":     "scaleway",
 	"aws":          "aws",
 	"cloudflare":   "cloudflare",
+	"rfc2136":      "rfc2136",
+	"kind":         "inmemory", // kind records are managed by workshopctl itself
 }
 
 var traefikDNSMap = map[string]string{
@@ -20,6 +22,7 @@ var traefikDNSMap = map[string]string{
 	"scaleway":     "scaleway",
 	"aws":          "route53",
 	"cloudflare":   "cloudflare",
+	"rfc2136":      "rfc2136",
 }
 
 func FromClusterInfo(cfg *config.ClusterInfo) *Parameters {
@@ -6,18 +6,25 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
 	"github.com/cloud-native-nordics/workshopctl/pkg/util"
 	"github.com/fluxcd/go-git-providers/gitprovider"
-	"github.com/sirupsen/logrus"
 	giturls "github.com/whilp/git-urls"
-	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/oauth2"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+// localProviders don't talk to any cloud API, and hence don't need a service account
+var localProviders = map[string]bool{
+	"kind": true,
+	"byo":  true,
+}
+
 type Config struct {
 	// The prefix to use for all identifying names/tags/etc.
 	// This allows an user to have multiple workshop environments at once in the same provider
@@ -34,9 +41,10 @@ type Config struct {
 	// Where to store the manifests for collaboration?
 	Git Git `json:"git"`
 
-	// If this is specified you can use "sealed secrets"
-	// TODO: Implement this with the help of Mozilla SOPS
-	// GPGKeyID string `json:"gpgKeyID"`
+	// Secrets configures encryption of the workshopctl Secret with Mozilla SOPS.
+	// If any recipients are specified, the Secret is committed encrypted to the git repo,
+	// and decrypted in-cluster by Flux.
+	Secrets Secrets `json:"secrets"`
 
 	// Whom to contact by Let's Encrypt
 	LetsEncryptEmail string `json:"letsEncryptEmail"`
@@ -46,16 +54,37 @@ type Config struct {
 	ClusterLogin ClusterLogin `json:"clusterLogin"`
 
 	NodeGroups []NodeGroup `json:"nodeGroups"`
+
+	// KubernetesVersion is either "latest", a minor version like "1.29", or an exact version as
+	// understood by the cloud provider. Defaults to "latest". What it resolves to on the first
+	// apply is recorded, so that all clusters of the workshop run the same version.
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+
+	// Budget optionally limits what the workshop may cost
+	Budget Budget `json:"budget"`
+
+	// TTL is how long clusters live after being created, e.g. "72h". Clusters are stamped with
+	// when they expire, and expired clusters are deleted by "workshopctl reap".
+	TTL string `json:"ttl,omitempty"`
+	// ExpiresAt is when all clusters expire, e.g. "2024-05-01T18:00:00Z". Takes precedence over TTL.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// Concurrency limits how many clusters are operated on in parallel, in order to stay below
+	// the rate limits of the providers. Defaults to 10.
+	Concurrency uint16 `json:"concurrency,omitempty"`
 }
 
+// LatestKubernetesVersion resolves to the newest Kubernetes version the cloud provider offers
+const LatestKubernetesVersion = "latest"
+
 func (c *Config) Validate() error {
 	if c.Name == "" {
 		return fmt.Errorf("name must not be empty")
 	}
-	if c.CloudProvider.ServiceAccountPath == "" {
+	if c.CloudProvider.ServiceAccountPath == "" && !localProviders[c.CloudProvider.Name] {
 		return fmt.Errorf("must specify cloud provider SA path")
 	}
-	if c.DNSProvider.ServiceAccountPath == "" {
+	if c.DNSProvider.ServiceAccountPath == "" && !localProviders[c.DNSProvider.Name] {
 		return fmt.Errorf("must specify DNS provider SA path")
 	}
 	if c.RootDomain == "" {
@@ -70,6 +99,24 @@ func (c *Config) Validate() error {
 	if c.Git.ServiceAccountPath == "" {
 		return fmt.Errorf("must specify git provider token")
 	}
+	if c.Secrets.Enabled() && c.Secrets.DecryptionKeyPath == "" {
+		return fmt.Errorf("must specify SOPS decryption key path when secrets recipients are set")
+	}
+	if c.TTL != "" {
+		if _, err := time.ParseDuration(c.TTL); err != nil {
+			return fmt.Errorf("invalid ttl %q: %w", c.TTL, err)
+		}
+	}
+	if c.Budget.Duration != "" {
+		if _, err := time.ParseDuration(c.Budget.Duration); err != nil {
+			return fmt.Errorf("invalid budget duration %q: %w", c.Budget.Duration, err)
+		}
+	}
+	for i, ng := range c.NodeGroups {
+		if err := ng.Validate(); err != nil {
+			return fmt.Errorf("node group %d: %w", i+1, err)
+		}
+	}
 	return nil
 }
 
@@ -87,6 +134,15 @@ func (c *Config) Complete(ctx context.Context) error {
 	if c.Clusters == 0 {
 		c.Clusters = 1
 	}
+	if c.Concurrency == 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+	if c.KubernetesVersion == "" {
+		c.KubernetesVersion = LatestKubernetesVersion
+	}
+	if c.Budget.Duration == "" {
+		c.Budget.Duration = DefaultBudgetDuration
+	}
 	if c.ClusterLogin.Username == "" {
 		c.ClusterLogin.Username = "workshopctl"
 	}
@@ -98,21 +154,18 @@ func (c *Config) Complete(ctx context.Context) error {
 		// TODO: This maybe shouldn't "leak" to the config file when marshalling?
 		c.ClusterLogin.CommonPassword = pass
 	}
-	if c.CloudProvider.ServiceAccountPath != "" {
-		saPath := util.JoinPaths(ctx, c.CloudProvider.ServiceAccountPath)
-		if err := readFileInto(saPath, &c.CloudProvider.ServiceAccountContent); err != nil {
-			return err
-		}
+	if err := c.CloudProvider.LoadServiceAccount(ctx); err != nil {
+		return err
 	}
-	if c.DNSProvider.ServiceAccountPath != "" {
-		saPath := util.JoinPaths(ctx, c.DNSProvider.ServiceAccountPath)
-		if err := readFileInto(saPath, &c.DNSProvider.ServiceAccountContent); err != nil {
-			return err
-		}
+	if err := c.DNSProvider.LoadServiceAccount(ctx); err != nil {
+		return err
 	}
-	if c.Git.ServiceAccountPath != "" {
-		saPath := util.JoinPaths(ctx, c.Git.ServiceAccountPath)
-		if err := readFileInto(saPath, &c.Git.ServiceAccountContent); err != nil {
+	if err := c.Git.LoadServiceAccount(ctx); err != nil {
+		return err
+	}
+	if c.Secrets.DecryptionKeyPath != "" {
+		keyPath := util.JoinPaths(ctx, c.Secrets.DecryptionKeyPath)
+		if err := readFileInto(keyPath, &c.Secrets.DecryptionKeyContent); err != nil {
 			return err
 		}
 	}
@@ -145,6 +198,18 @@ func (c *Config) Complete(ctx context.Context) error {
 	return nil
 }
 
+// ClusterExpiry returns when a cluster created at the given time expires, or nil if it never does
+func (c *Config) ClusterExpiry(created time.Time) *time.Time {
+	if c.ExpiresAt != nil {
+		return c.ExpiresAt
+	}
+	if ttl, err := time.ParseDuration(c.TTL); err == nil && ttl > 0 {
+		expiry := created.Add(ttl).UTC()
+		return &expiry
+	}
+	return nil
+}
+
 type ServiceAccount struct {
 	// ServiceAccountPath specifies the file path to the service account
 	ServiceAccountPath string `json:"serviceAccountPath"`
@@ -152,6 +217,14 @@ type ServiceAccount struct {
 	ServiceAccountContent string `json:"-"`
 }
 
+// LoadServiceAccount reads ServiceAccountContent from ServiceAccountPath, if set
+func (sa *ServiceAccount) LoadServiceAccount(ctx context.Context) error {
+	if sa.ServiceAccountPath == "" {
+		return nil
+	}
+	return readFileInto(util.JoinPaths(ctx, sa.ServiceAccountPath), &sa.ServiceAccountContent)
+}
+
 // If the ServiceAccount is an oauth2 token, this helper method might be useful for
 // the implementing provider
 func (sa ServiceAccount) TokenSource() oauth2.TokenSource {
@@ -159,7 +232,8 @@ func (sa ServiceAccount) TokenSource() oauth2.TokenSource {
 }
 
 type Provider struct {
-	// Name of the provider. For now, only "digitalocean" is supported.
+	// Name of the provider. Cloud providers: "digitalocean", "hetzner", "kind" and "byo".
+	// DNS providers: "digitalocean", "cloudflare", "aws", "rfc2136" and "kind".
 	Name string `json:"name"`
 	// The ServiceAccount struct is embedded and inlined into the provider
 	ServiceAccount `json:",inline"`
@@ -168,8 +242,74 @@ type Provider struct {
 }
 
 type NodeGroup struct {
-	Instances uint16    `json:"instances"`
-	NodeClaim NodeClaim `json:"nodeClaim"`
+	// Instances is the amount of nodes. If the node group autoscales, it's the amount of nodes it
+	// starts with.
+	Instances uint16 `json:"instances"`
+	// If MaxInstances is set, the node group autoscales between MinInstances and MaxInstances
+	// nodes, given that the cloud provider supports it. Otherwise, Instances nodes are created.
+	MinInstances uint16    `json:"minInstances,omitempty"`
+	MaxInstances uint16    `json:"maxInstances,omitempty"`
+	NodeClaim    NodeClaim `json:"nodeClaim"`
+
+	// Labels and Taints are set on the nodes of the node group, e.g. to keep attendee workloads
+	// off the nodes running the workshop infra
+	Labels map[string]string `json:"labels,omitempty"`
+	Taints []Taint           `json:"taints,omitempty"`
+}
+
+// Autoscales tells whether the node group autoscales
+func (ng NodeGroup) Autoscales() bool {
+	return ng.MaxInstances != 0
+}
+
+func (ng NodeGroup) Validate() error {
+	if ng.MinInstances != 0 && !ng.Autoscales() {
+		return fmt.Errorf("minInstances requires maxInstances to be set")
+	}
+	if ng.Autoscales() && (ng.Instances < ng.MinInstances || ng.Instances > ng.MaxInstances) {
+		return fmt.Errorf("instances must be between minInstances %d and maxInstances %d, got %d", ng.MinInstances, ng.MaxInstances, ng.Instances)
+	}
+	for k, v := range ng.Labels {
+		if errs := validation.IsQualifiedName(k); len(errs) != 0 {
+			return fmt.Errorf("invalid label key %q: %s", k, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) != 0 {
+			return fmt.Errorf("invalid label value %q: %s", v, strings.Join(errs, ", "))
+		}
+	}
+	for _, t := range ng.Taints {
+		if errs := validation.IsQualifiedName(t.Key); len(errs) != 0 {
+			return fmt.Errorf("invalid taint key %q: %s", t.Key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(t.Value); len(errs) != 0 {
+			return fmt.Errorf("invalid taint value %q: %s", t.Value, strings.Join(errs, ", "))
+		}
+		if !taintEffects[t.Effect] {
+			return fmt.Errorf("invalid taint effect %q, expected NoSchedule, PreferNoSchedule or NoExecute", t.Effect)
+		}
+	}
+	return nil
+}
+
+type Taint struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// Effect is either NoSchedule, PreferNoSchedule or NoExecute
+	Effect string `json:"effect"`
+}
+
+// String returns the taint in the "key=value:Effect" form that kubectl and k3s understand
+func (t Taint) String() string {
+	if t.Value == "" {
+		return fmt.Sprintf("%s:%s", t.Key, t.Effect)
+	}
+	return fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect)
+}
+
+var taintEffects = map[string]bool{
+	"NoSchedule":       true,
+	"PreferNoSchedule": true,
+	"NoExecute":        true,
 }
 
 type NodeClaim struct {
@@ -197,9 +337,56 @@ type ClusterLogin struct {
 	// UniquePasswords tells whether every cluster should have its own password.
 	// By default false, which means all clusters share CommonPassword. If true,
 	// CommonPassword will be ignored and all clusters' passwords will be generated.
+	// Generated passwords are stored in ./clusters/<cluster>/.credentials and re-used.
 	UniquePasswords bool `json:"uniquePasswords"`
 }
 
+// DefaultBudgetDuration is how long the clusters are planned to run by default, i.e. a workshop day
+const DefaultBudgetDuration = "8h"
+
+type Budget struct {
+	// Amount is the most the clusters may cost in total during Duration, in the currency the cloud
+	// provider's prices are in. Zero means no limit.
+	Amount float64 `json:"amount,omitempty"`
+	// Duration is how long the clusters are planned to run, e.g. "8h". Defaults to 8h.
+	Duration string `json:"duration,omitempty"`
+	// Enforce makes apply refuse to run when the estimated cost of the clusters it would create is
+	// above Amount, instead of warning.
+	Enforce bool `json:"enforce,omitempty"`
+}
+
+// PlannedDuration returns Duration parsed. Duration is validated when loading the config.
+func (b Budget) PlannedDuration() time.Duration {
+	d, _ := time.ParseDuration(b.Duration)
+	return d
+}
+
+type Secrets struct {
+	// AgeRecipients are the age public keys the workshopctl Secret is encrypted for
+	AgeRecipients []string `json:"ageRecipients,omitempty"`
+	// PGPFingerprints are the fingerprints of the PGP keys the workshopctl Secret is encrypted for
+	PGPFingerprints []string `json:"pgpFingerprints,omitempty"`
+	// DecryptionKeyPath specifies the file path to the private age or PGP key that Flux uses
+	// to decrypt the Secret in-cluster. The key is pushed to the clusters at apply-time, never to git.
+	DecryptionKeyPath string `json:"decryptionKeyPath,omitempty"`
+	// The contents of DecryptionKeyPath, read at runtime and never marshalled.
+	DecryptionKeyContent string `json:"-"`
+}
+
+// Enabled tells whether the workshopctl Secret should be encrypted with SOPS
+func (s Secrets) Enabled() bool {
+	return len(s.AgeRecipients) != 0 || len(s.PGPFingerprints) != 0
+}
+
+// DecryptionKeyName returns the key under which the decryption key is stored in the
+// Secret Flux reads. Flux requires age keys to end with .agekey and PGP keys with .asc.
+func (s Secrets) DecryptionKeyName() string {
+	if strings.Contains(s.DecryptionKeyContent, "AGE-SECRET-KEY-") {
+		return "identity.agekey"
+	}
+	return "sops.asc"
+}
+
 type Tutorials struct {
 	Repo string `json:"repo"`
 	Dir  string `json:"dir"`
@@ -207,24 +394,16 @@ type Tutorials struct {
 
 type ClusterInfo struct {
 	*Config
-	Index    ClusterNumber
-	Password string
+	Index ClusterNumber
+	*Credentials
 }
 
-func NewClusterInfo(ctx context.Context, cfg *Config, i ClusterNumber) *ClusterInfo {
-	pass := cfg.ClusterLogin.CommonPassword
-	if cfg.ClusterLogin.UniquePasswords {
-		var err error
-		pass, err = util.RandomSHA(4) // TODO: constant
-		if err != nil {
-			panic(err)
-		}
-		// Warn about possible misconfigurations
-		if len(cfg.ClusterLogin.CommonPassword) != 0 {
-			util.Logger(ctx).Warnf("You have specified both .ClusterLogin.UniquePasswords and .ClusterLogin.CommonPassword. UniquePasswords has higher priority and hence CommonPassword is ignored.")
-		}
+func NewClusterInfo(ctx context.Context, cfg *Config, i ClusterNumber) (*ClusterInfo, error) {
+	creds, err := loadCredentials(ctx, cfg, i)
+	if err != nil {
+		return nil, err
 	}
-	return &ClusterInfo{cfg, i, pass}
+	return &ClusterInfo{cfg, i, creds}, nil
 }
 
 func (c *ClusterInfo) Domain() string {
@@ -232,11 +411,7 @@ func (c *ClusterInfo) Domain() string {
 }
 
 func (c *ClusterInfo) BasicAuth() string {
-	hash, err := bcrypt.GenerateFromPassword([]byte(c.Password), bcrypt.DefaultCost)
-	if err != nil {
-		panic(err)
-	}
-	return fmt.Sprintf("%s:%s", c.ClusterLogin.Username, hash)
+	return fmt.Sprintf("%s:%s", c.ClusterLogin.Username, c.BasicAuthHash)
 }
 
 var _ fmt.Stringer = ClusterNumber(0)
@@ -263,36 +438,76 @@ func (n ClusterNumber) KubeConfigPath() string {
 	return filepath.Join(n.ClusterDir(), constants.KubeconfigFile)
 }
 
-func ForCluster(ctx context.Context, n uint16, cfg *Config, fn func(context.Context, *ClusterInfo) error) error {
-	logrus.Debugf("Running function for all %d clusters", n)
+func (n ClusterNumber) CredentialsPath() string {
+	return filepath.Join(n.ClusterDir(), constants.CredentialsFile)
+}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(int(n))
-	foundErr := false
+// ClusterNumbers is a sorted list of unique cluster numbers
+type ClusterNumbers []ClusterNumber
 
-	// mutex shared by cluster threads when they need to coordinate
-	// TODO: This is limited to only one lock operation, consider supporting more in the future
-	mux := &sync.Mutex{}
+// AllClusters returns the cluster numbers from 1 to n
+func AllClusters(n uint16) ClusterNumbers {
+	numbers := make(ClusterNumbers, 0, n)
 	for i := ClusterNumber(1); i <= ClusterNumber(n); i++ {
-		go func(j ClusterNumber) {
-			clusterCtx := util.WithClusterNumber(ctx, uint16(j))
-			clusterCtx = util.WithMutex(clusterCtx, mux)
-			logger := util.Logger(clusterCtx)
-			logger.Tracef("ForCluster goroutine starting...")
-			clusterInfo := NewClusterInfo(clusterCtx, cfg, j)
-			if err := fn(clusterCtx, clusterInfo); err != nil {
-				logger.Error(err)
-				foundErr = true
+		numbers = append(numbers, i)
+	}
+	return numbers
+}
+
+// ParseClusterNumbers parses a comma-separated list of cluster numbers and ranges, e.g. "3,5-8"
+func ParseClusterNumbers(str string) (ClusterNumbers, error) {
+	set := map[ClusterNumber]bool{}
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := parseClusterNumber(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = parseClusterNumber(bounds[1]); err != nil {
+				return nil, err
 			}
-			logger.Tracef("ForCluster goroutine is done")
-			wg.Done()
-		}(i)
+		}
+		if from > to {
+			return nil, fmt.Errorf("invalid cluster range %q, %d is larger than %d", part, from, to)
+		}
+		// Loop over a wider type, as i would wrap around after the largest ClusterNumber
+		for i := uint32(from); i <= uint32(to); i++ {
+			set[ClusterNumber(i)] = true
+		}
 	}
-	wg.Wait()
-	if foundErr {
-		return fmt.Errorf("an error occured previously")
+	if len(set) == 0 {
+		return nil, fmt.Errorf("no clusters given in %q", str)
 	}
-	return nil
+	numbers := make(ClusterNumbers, 0, len(set))
+	for i := range set {
+		numbers = append(numbers, i)
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		return numbers[i] < numbers[j]
+	})
+	return numbers, nil
+}
+
+func parseClusterNumber(str string) (ClusterNumber, error) {
+	n, err := strconv.ParseUint(strings.TrimSpace(str), 10, 16)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid cluster number %q, expected a positive integer", str)
+	}
+	return ClusterNumber(n), nil
+}
+
+func (ns ClusterNumbers) String() string {
+	strs := make([]string, 0, len(ns))
+	for _, n := range ns {
+		strs = append(strs, n.String())
+	}
+	return strings.Join(strs, ",")
 }
 
 func readFileInto(file string, target *string) error {
@@ -8,6 +8,10 @@ const (
 	ClustersDir = "clusters"
 	CacheDir    = ".cache"
 
+	// Top-level files, i.e. ./
+	// KubernetesVersionFile records what the configured Kubernetes version resolved to
+	KubernetesVersionFile = "kubernetes-version.json"
+
 	// Under ./{ChartsDir}/<chart>/
 	// Helm-specific
 	TemplatesDir = "templates"
@@ -21,17 +25,33 @@ const (
 	ValuesJS = "values.js"
 
 	// Under ./{ClustersDir}/<cluster>/
-	KubeconfigFile = ".kubeconfig"
+	KubeconfigFile  = ".kubeconfig"
+	CredentialsFile = ".credentials"
+	// The SOPS-encrypted workshopctl Secret
+	EncryptedSecretFile = "workshopctl-secret.sops.yaml"
+	// Under ./{ClustersDir}/<cluster>/{FluxNamespace}/
+	FluxKustomizationFile = "kustomization.yaml"
 
 	// The default namespace in k8s is called "default"
 	DefaultNamespace     = "default"
 	WorkshopctlNamespace = "workshopctl"
 
 	WorkshopctlSecret = "workshopctl"
+	// WorkshopctlConfigMap records which phases of apply are done for the cluster
+	WorkshopctlConfigMap = "workshopctl"
+
+	// Flux is installed into this namespace, and reads the SOPS decryption key from the given Secret
+	FluxNamespace = "flux-system"
+	SOPSSecret    = "sops-keys"
 )
 
 func ClusterName(namePrefix string, index fmt.Stringer) string {
-	return fmt.Sprintf("workshopctl-%s-%s", namePrefix, index)
+	return ClusterNamePrefix(namePrefix) + index.String()
+}
+
+// ClusterNamePrefix is what the names of all clusters of a workshop start with
+func ClusterNamePrefix(namePrefix string) string {
+	return fmt.Sprintf("workshopctl-%s-", namePrefix)
 }
 
 // These files will be copied from ./charts/<chart>/<file> to ./.cache/<chart>/<file>
@@ -0,0 +1,141 @@
+package cost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+// Estimate is what the clusters of the workshop are expected to cost
+type Estimate struct {
+	Currency string
+	Clusters uint16
+	Duration time.Duration
+
+	NodeGroups []NodeGroupCost
+	// LoadBalancer is the hourly price of the load balancer of one cluster
+	LoadBalancer float64
+	// ClusterHourly is the hourly price of one cluster
+	ClusterHourly float64
+	// Hourly is the hourly price of all clusters
+	Hourly float64
+	// Total is the price of all clusters during Duration
+	Total float64
+	// MaxTotal is the price of all clusters during Duration, if all autoscaling node groups are
+	// scaled up to their maximum. It's the same as Total if no node group autoscales.
+	MaxTotal float64
+}
+
+// NodeGroupCost is what one node group of a cluster costs
+type NodeGroupCost struct {
+	config.NodeGroup
+	// NodeHourly is the hourly price of one node
+	NodeHourly float64
+	// Hourly is the hourly price of all nodes of the node group
+	Hourly float64
+	// MaxHourly is the hourly price of the maximum amount of nodes of the node group
+	MaxHourly float64
+}
+
+// Compute asks the cloud provider for prices, and estimates what the given amount of clusters cost
+// when running for the given duration
+func Compute(ctx context.Context, cfg *config.Config, cloudP provider.CloudProvider, clusters uint16, d time.Duration) (*Estimate, error) {
+	pricer, ok := cloudP.(provider.Pricer)
+	if !ok {
+		return nil, fmt.Errorf("cloud provider %q can't tell what clusters cost", cfg.CloudProvider.Name)
+	}
+	prices, err := pricer.Prices(ctx, provider.ClusterSpec{NodeGroups: cfg.NodeGroups})
+	if err != nil {
+		return nil, err
+	}
+	util.DebugObject(ctx, "Got prices from the cloud provider", prices)
+
+	e := &Estimate{
+		Currency:      prices.Currency,
+		Clusters:      clusters,
+		Duration:      d,
+		LoadBalancer:  prices.LoadBalancer,
+		ClusterHourly: prices.LoadBalancer,
+	}
+	maxClusterHourly := prices.LoadBalancer
+	for i, ng := range cfg.NodeGroups {
+		ngc := NodeGroupCost{
+			NodeGroup:  ng,
+			NodeHourly: prices.NodeGroups[i],
+			Hourly:     prices.NodeGroups[i] * float64(ng.Instances),
+		}
+		ngc.MaxHourly = ngc.Hourly
+		if ng.Autoscales() {
+			ngc.MaxHourly = prices.NodeGroups[i] * float64(ng.MaxInstances)
+		}
+		e.NodeGroups = append(e.NodeGroups, ngc)
+		e.ClusterHourly += ngc.Hourly
+		maxClusterHourly += ngc.MaxHourly
+	}
+	e.Hourly = e.ClusterHourly * float64(e.Clusters)
+	e.Total = e.Hourly * d.Hours()
+	e.MaxTotal = maxClusterHourly * float64(e.Clusters) * d.Hours()
+	return e, nil
+}
+
+// Write writes the estimate as a table to w
+func Write(w io.Writer, e *Estimate) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ITEM\tAMOUNT\tPER HOUR (%s)\n", e.Currency)
+	for i, ngc := range e.NodeGroups {
+		amount := fmt.Sprint(ngc.Instances)
+		if ngc.Autoscales() {
+			amount += fmt.Sprintf(" (%d-%d)", ngc.MinInstances, ngc.MaxInstances)
+		}
+		fmt.Fprintf(tw, "node group %d (%d CPUs/%dGB RAM)\t%s\t%.4f\n", i+1, ngc.NodeClaim.CPU, ngc.NodeClaim.RAM, amount, ngc.Hourly)
+	}
+	fmt.Fprintf(tw, "load balancer\t1\t%.4f\n", e.LoadBalancer)
+	fmt.Fprintf(tw, "per cluster\t\t%.4f\n", e.ClusterHourly)
+	fmt.Fprintf(tw, "all clusters\t%d\t%.4f\n", e.Clusters, e.Hourly)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "\nTotal for %s: %.2f %s\n", e.Duration, e.Total, e.Currency); err != nil {
+		return err
+	}
+	if e.MaxTotal == e.Total {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "Up to %.2f %s if the autoscaling node groups scale up to their maxInstances\n", e.MaxTotal, e.Currency)
+	return err
+}
+
+// CheckBudget estimates the cost of the clusters to create when running for the planned duration.
+// If that is above the budget, an error is returned if the budget is enforced, otherwise a warning
+// is logged.
+func CheckBudget(ctx context.Context, cfg *config.Config, cloudP provider.CloudProvider, toCreate uint16) error {
+	logger := util.Logger(ctx)
+	if cfg.Budget.Amount == 0 || toCreate == 0 {
+		return nil
+	}
+	if _, ok := cloudP.(provider.Pricer); !ok {
+		logger.Warnf("Can't check the budget, as cloud provider %q can't tell what clusters cost", cfg.CloudProvider.Name)
+		return nil
+	}
+
+	e, err := Compute(ctx, cfg, cloudP, toCreate, cfg.Budget.PlannedDuration())
+	if err != nil {
+		return err
+	}
+	if e.Total <= cfg.Budget.Amount {
+		logger.Infof("Estimated cost of the %d clusters to create for %s is %.2f %s, within the budget of %.2f", e.Clusters, e.Duration, e.Total, e.Currency, cfg.Budget.Amount)
+		return nil
+	}
+	msg := fmt.Sprintf("estimated cost of the %d clusters to create for %s is %.2f %s, which is above the budget of %.2f", e.Clusters, e.Duration, e.Total, e.Currency, cfg.Budget.Amount)
+	if cfg.Budget.Enforce {
+		return fmt.Errorf("%s. Reduce the clusters or node groups, or raise the budget", msg)
+	}
+	logger.Warn(msg)
+	return nil
+}
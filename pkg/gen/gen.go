@@ -121,18 +121,9 @@ func downloadChart(ctx context.Context, externalChartFile string) error {
 		externalChart = filepath.Join(crepo, cname)
 
 		// Make sure the repo is registered correctly
-		out, _, err := util.Command(ctx, "helm", "repo", "list").Run()
-		if err != nil {
+		if err := ensureHelmRepo(ctx, crepo, u.String()); err != nil {
 			return err
 		}
-		// Only add the repo if it doesn't already exist
-		if !strings.Contains(out, crepo) {
-			log.Infof("Adding a new helm repo called %q pointing to %q", crepo, u.String())
-			_, _, err = util.Command(ctx, "helm", "repo", "add", crepo, u.String()).Run()
-			if err != nil {
-				return err
-			}
-		}
 	} else {
 		arr := strings.Split(externalChart, "/")
 		if len(arr) != 2 {
@@ -145,6 +136,8 @@ func downloadChart(ctx context.Context, externalChartFile string) error {
 	cacheDir := util.JoinPaths(ctx, constants.CacheDir)
 	tmpCacheDir := util.JoinPaths(ctx, cacheDir, "tmp")
 
+	unlock := util.Lock(ctx, util.LockCacheTmp)
+	defer unlock()
 	if exists, _ := util.PathExists(tmpCacheDir); exists {
 		if err := os.RemoveAll(tmpCacheDir); err != nil {
 			return err
@@ -158,6 +151,26 @@ func downloadChart(ctx context.Context, externalChartFile string) error {
 	return util.Copy(tmpCacheDir, cacheDir)
 }
 
+// ensureHelmRepo adds the helm repo unless it already exists. The lock is only held while
+// registering the repo, so that charts of different clusters can be downloaded meanwhile.
+func ensureHelmRepo(ctx context.Context, name, repoURL string) error {
+	unlock := util.Lock(ctx, util.LockHelmRepos)
+	defer unlock()
+	out, _, err := util.Command(ctx, "helm", "repo", "list").Run()
+	if err != nil {
+		return err
+	}
+	// Only add the repo if it doesn't already exist
+	if !strings.Contains(out, name) {
+		log.Infof("Adding a new helm repo called %q pointing to %q", name, repoURL)
+		_, _, err = util.Command(ctx, "helm", "repo", "add", name, repoURL).Run()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func GenerateChart(ctx context.Context, cd *ChartData, clusterInfo *config.ClusterInfo, valuesProcessors, chartProcessors []Processor) error {
 	logger := util.Logger(ctx).WithField("chart", cd.Name)
 
@@ -0,0 +1,111 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/config/keyval"
+	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"sigs.k8s.io/yaml"
+)
+
+// fluxKustomization patches the flux-system Kustomization created by "flux bootstrap" so that
+// it decrypts SOPS-encrypted manifests. "flux bootstrap" keeps the patches of an existing file.
+const fluxKustomization = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- gotk-components.yaml
+- gotk-sync.yaml
+patches:
+- target:
+    kind: Kustomization
+    name: flux-system
+  patch: |
+    - op: add
+      path: /spec/decryption
+      value:
+        provider: sops
+        secretRef:
+          name: {{ .SecretName }}
+`
+
+type secretManifest struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   secretMeta        `json:"metadata"`
+	Type       string            `json:"type"`
+	StringData map[string]string `json:"stringData"`
+}
+
+type secretMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// GenerateSecret writes the workshopctl Secret encrypted with SOPS to ./clusters/<cluster>/,
+// together with the patch that makes Flux decrypt it in-cluster.
+func GenerateSecret(ctx context.Context, clusterInfo *config.ClusterInfo) error {
+	logger := util.Logger(ctx)
+
+	secret := secretManifest{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: secretMeta{
+			Name:      constants.WorkshopctlSecret,
+			Namespace: constants.WorkshopctlNamespace,
+		},
+		Type:       "Opaque",
+		StringData: keyval.FromClusterInfo(clusterInfo).ToMap(),
+	}
+	b, err := yaml.Marshal(secret)
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"--encrypt",
+		// Only encrypt the values, so that Flux and humans still can read the metadata
+		"--encrypted-regex", "^(data|stringData)$",
+		"--input-type", "yaml",
+		"--output-type", "yaml",
+	}
+	if recipients := clusterInfo.Secrets.AgeRecipients; len(recipients) != 0 {
+		args = append(args, "--age", strings.Join(recipients, ","))
+	}
+	if fingerprints := clusterInfo.Secrets.PGPFingerprints; len(fingerprints) != 0 {
+		args = append(args, "--pgp", strings.Join(fingerprints, ","))
+	}
+	// Read the plaintext Secret from stdin, so it never touches the disk
+	args = append(args, "/dev/stdin")
+
+	logger.Infof("Encrypting the %s Secret with SOPS...", constants.WorkshopctlSecret)
+	encrypted := new(bytes.Buffer)
+	if _, _, err := util.Command(ctx, "sops", args...).
+		WithStdio(bytes.NewReader(b), encrypted, nil).
+		Run(); err != nil {
+		return err
+	}
+
+	clusterDir := util.JoinPaths(ctx, clusterInfo.Index.ClusterDir())
+	fluxDir := filepath.Join(clusterDir, constants.FluxNamespace)
+	// TODO: Make "fake" os.MkdirAll and os.Create util calls that can be used for dry-running
+	if err := os.MkdirAll(fluxDir, 0755); err != nil {
+		return err
+	}
+	if err := util.WriteFile(ctx, filepath.Join(clusterDir, constants.EncryptedSecretFile), encrypted.Bytes()); err != nil {
+		return err
+	}
+
+	kustomization, err := util.ApplyTemplate(fluxKustomization, map[string]string{
+		"SecretName": constants.SOPSSecret,
+	})
+	if err != nil {
+		return err
+	}
+	return util.WriteFile(ctx, filepath.Join(fluxDir, constants.FluxKustomizationFile), kustomization)
+}
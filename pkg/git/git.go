@@ -46,13 +46,17 @@ func PushManifests(ctx context.Context, cfg *config.Config) error {
 	oldGitIgnore := string(gitIgnoreBytes)
 
 	var foundTokens = map[string]bool{
-		".cache":      false,
-		".kube":       false,
-		".kubeconfig": false,
+		".cache":       false,
+		".kube":        false,
+		".kubeconfig":  false,
+		".credentials": false,
 	}
 	foundTokens[cfg.DNSProvider.ServiceAccountPath] = false
 	foundTokens[cfg.CloudProvider.ServiceAccountPath] = false
 	foundTokens[cfg.Git.ServiceAccountPath] = false
+	if cfg.Secrets.DecryptionKeyPath != "" {
+		foundTokens[cfg.Secrets.DecryptionKeyPath] = false
+	}
 
 	fileScanner := bufio.NewScanner(strings.NewReader(oldGitIgnore))
 	fileScanner.Split(bufio.ScanLines)
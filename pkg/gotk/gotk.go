@@ -11,17 +11,11 @@ import (
 )
 
 func SetupGitOps(ctx context.Context, info *config.ClusterInfo) error {
-	mux, ok := util.GetMutex(ctx)
-	if !ok || mux == nil {
-		return fmt.Errorf("SetupGitOps: programmer error, couldn't get mutex for locking: %v", mux)
-	}
-
 	logger := util.Logger(ctx)
-	logger.Debug("Waiting for mutex unlock in SetupGitOps")
 	// Lock during this operation, as the git repo is mutually exclusive
-	mux.Lock()
+	unlock := util.Lock(ctx, util.LockGit)
+	defer unlock()
 	logger.Infof("Bootstrapping GitOps for cluster %s...", info.Index)
-	defer mux.Unlock()
 	defer logger.Infof("Bootstrapping GitOps for cluster %s is done!", info.Index)
 
 	// Make sure we have all prereqs
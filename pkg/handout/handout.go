@@ -0,0 +1,155 @@
+package handout
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"sync"
+	"text/template"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+type Format string
+
+const (
+	FormatCSV      Format = "csv"
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+)
+
+var Formats = []Format{FormatCSV, FormatMarkdown, FormatHTML}
+
+// Handout contains everything an attendee needs to know to access their cluster
+type Handout struct {
+	Cluster      config.ClusterNumber
+	Domain       string
+	CodeURL      string
+	DashboardURL string
+	Username     string
+	Password     string
+	// QRCode is a base64-encoded PNG pointing to CodeURL. Only set if requested.
+	QRCode string
+}
+
+// Collect builds the handouts for all clusters, sorted by cluster number. If qrCodes is
+// true, a QR code pointing to the Visual Studio Code URL is generated for every cluster.
+func Collect(ctx context.Context, cfg *config.Config, qrCodes bool) ([]*Handout, error) {
+	mux := &sync.Mutex{}
+	handouts := make([]*Handout, 0, cfg.Clusters)
+	err := config.ForCluster(ctx, config.AllClusters(cfg.Clusters), cfg, func(_ context.Context, info *config.ClusterInfo) error {
+		h, err := newHandout(info, qrCodes)
+		if err != nil {
+			return err
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		handouts = append(handouts, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(handouts, func(i, j int) bool {
+		return handouts[i].Cluster < handouts[j].Cluster
+	})
+	return handouts, nil
+}
+
+func newHandout(info *config.ClusterInfo, qrCodes bool) (*Handout, error) {
+	h := &Handout{
+		Cluster:      info.Index,
+		Domain:       info.Domain(),
+		CodeURL:      fmt.Sprintf("https://%s", info.Domain()),
+		DashboardURL: fmt.Sprintf("https://dashboard.%s", info.Domain()),
+		Username:     info.ClusterLogin.Username,
+		Password:     info.Password,
+	}
+	if qrCodes {
+		png, err := qrcode.Encode(h.CodeURL, qrcode.Medium, 256)
+		if err != nil {
+			return nil, err
+		}
+		h.QRCode = base64.StdEncoding.EncodeToString(png)
+	}
+	return h, nil
+}
+
+// Write writes the handouts to w in the given format
+func Write(w io.Writer, handouts []*Handout, format Format) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, handouts)
+	case FormatMarkdown:
+		return markdownTemplate.Execute(w, handouts)
+	case FormatHTML:
+		return htmlTemplate.Execute(w, handouts)
+	default:
+		return fmt.Errorf("invalid handout format %q, expected one of %v", format, Formats)
+	}
+}
+
+func writeCSV(w io.Writer, handouts []*Handout) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"cluster", "domain", "url", "dashboard", "username", "password"}); err != nil {
+		return err
+	}
+	for _, h := range handouts {
+		if err := cw.Write([]string{h.Cluster.String(), h.Domain, h.CodeURL, h.DashboardURL, h.Username, h.Password}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var markdownTemplate = template.Must(template.New("markdown").Parse(`# Workshop credentials
+{{ range . }}
+## Cluster {{ .Cluster }}
+
+| | |
+|---|---|
+| Visual Studio Code | <{{ .CodeURL }}> |
+| Kubernetes Dashboard | <{{ .DashboardURL }}> |
+| Username | ` + "`{{ .Username }}`" + ` |
+| Password | ` + "`{{ .Password }}`" + ` |
+{{ if .QRCode }}
+![{{ .CodeURL }}](data:image/png;base64,{{ .QRCode }})
+{{ end }}{{ end }}`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+	"pngURL": func(b64 string) htmltemplate.URL {
+		return htmltemplate.URL("data:image/png;base64," + b64)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Workshop credentials</title>
+<style>
+body { font-family: sans-serif; }
+.handout { page-break-after: always; padding: 2em; }
+.handout:last-child { page-break-after: auto; }
+td { padding: 0.3em 1em 0.3em 0; }
+code { font-size: 1.3em; }
+</style>
+</head>
+<body>
+{{ range . }}<div class="handout">
+<h1>Cluster {{ .Cluster }}</h1>
+<table>
+<tr><td>Visual Studio Code</td><td><a href="{{ .CodeURL }}">{{ .CodeURL }}</a></td></tr>
+<tr><td>Kubernetes Dashboard</td><td><a href="{{ .DashboardURL }}">{{ .DashboardURL }}</a></td></tr>
+<tr><td>Username</td><td><code>{{ .Username }}</code></td></tr>
+<tr><td>Password</td><td><code>{{ .Password }}</code></td></tr>
+</table>
+{{ if .QRCode }}<img src="{{ pngURL .QRCode }}" alt="{{ .CodeURL }}">
+{{ end }}</div>
+{{ end }}</body>
+</html>
+`))
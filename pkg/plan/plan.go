@@ -0,0 +1,277 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+type Action string
+
+const (
+	// ActionCreate means apply would create the cluster
+	ActionCreate Action = "create"
+	// ActionExcess means the cluster is above cfg.Clusters. Apply leaves it alone, it is only
+	// deleted by "cleanup --excess".
+	ActionExcess Action = "excess"
+	// ActionDrift means the cluster differs from the config. Apply never changes existing
+	// clusters, hence the cluster has to be re-created to fix that.
+	ActionDrift    Action = "drift"
+	ActionNoChange Action = "no-change"
+)
+
+var actionSymbols = map[Action]string{
+	ActionCreate:   "+",
+	ActionExcess:   "-",
+	ActionDrift:    "~",
+	ActionNoChange: " ",
+}
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+var Formats = []Format{FormatText, FormatJSON}
+
+// Plan describes what apply would do to reach the desired state in the config, what it can't fix,
+// and what "cleanup --excess" would delete
+type Plan struct {
+	Clusters []*ClusterPlan `json:"clusters"`
+	// Summary counts the clusters per action
+	Summary map[Action]int `json:"summary"`
+}
+
+// ClusterPlan describes what would happen to one cluster
+type ClusterPlan struct {
+	Cluster config.ClusterNumber `json:"cluster"`
+	Name    string               `json:"name"`
+	Action  Action               `json:"action"`
+	// Changes are human-readable details about the action
+	Changes []string `json:"changes,omitempty"`
+	// Kubeconfig tells whether ./clusters/<cluster>/.kubeconfig exists
+	Kubeconfig bool `json:"kubeconfig"`
+	// DNSRecords is the amount of records under the cluster domain. It is nil if the DNS
+	// provider can't list records.
+	DNSRecords *int `json:"dnsRecords,omitempty"`
+}
+
+// Compute asks the providers what exists, and compares that with the clusters and node groups
+// in the config. Clusters above cfg.Clusters are reported as excess.
+func Compute(ctx context.Context, cfg *config.Config, cloudP provider.CloudProvider, dnsP provider.DNSProvider) (*Plan, error) {
+	logger := util.Logger(ctx)
+
+	logger.Debug("Listing existing clusters...")
+	existing, err := cloudP.ListClusters(ctx, cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	actual := map[config.ClusterNumber]*provider.Cluster{}
+	for _, c := range existing {
+		actual[c.Index] = c
+	}
+
+	// Plan all desired clusters, and all existing ones, which might be more
+	indexes := map[config.ClusterNumber]bool{}
+	for i := config.ClusterNumber(1); i <= config.ClusterNumber(cfg.Clusters); i++ {
+		indexes[i] = true
+	}
+	for i := range actual {
+		indexes[i] = true
+	}
+
+	p := &Plan{
+		Clusters: make([]*ClusterPlan, 0, len(indexes)),
+		Summary:  map[Action]int{},
+	}
+	for i := range indexes {
+		m := provider.ClusterMeta{
+			NamePrefix: cfg.Name,
+			Index:      i,
+		}
+		cp := &ClusterPlan{
+			Cluster:    i,
+			Name:       m.Name(),
+			Kubeconfig: util.FileExists(util.JoinPaths(ctx, i.KubeConfigPath())),
+		}
+
+		desired := i <= config.ClusterNumber(cfg.Clusters)
+		cluster, exists := actual[i]
+		switch {
+		case desired && !exists:
+			cp.Action = ActionCreate
+			for j, ng := range cfg.NodeGroups {
+				cp.Changes = append(cp.Changes, fmt.Sprintf("node group %d: %s", j+1, nodeGroupStr(ng)))
+			}
+		case !desired:
+			cp.Action = ActionExcess
+			cp.Changes = append(cp.Changes, `would be deleted by "workshopctl cleanup --excess"`)
+		default:
+			cp.Changes = diffNodeGroups(cfg.NodeGroups, cluster.Spec.NodeGroups)
+			cp.Action = ActionNoChange
+			if len(cp.Changes) != 0 {
+				cp.Action = ActionDrift
+				cp.Changes = append(cp.Changes, "apply doesn't change existing clusters, delete and re-create the cluster to fix this")
+			}
+			if !cp.Kubeconfig {
+				cp.Changes = append(cp.Changes, "kubeconfig is missing locally, it would be fetched from the provider")
+			}
+		}
+
+		if lister, ok := dnsP.(provider.RecordsLister); ok {
+			records, err := lister.ListRecords(ctx, m)
+			if err != nil {
+				return nil, err
+			}
+			n := len(records)
+			cp.DNSRecords = &n
+			// "cleanup --excess" only deletes the records created by external-dns, unless forced
+			cleanup := provider.OwnedRecords(records, i.Domain(cfg.RootDomain))
+			if len(cleanup) != 0 && cp.Action == ActionExcess {
+				cp.Changes = append(cp.Changes, fmt.Sprintf("%d DNS records would be cleaned up", len(cleanup)))
+			} else if n != 0 && cp.Action == ActionCreate {
+				cp.Changes = append(cp.Changes, fmt.Sprintf("%d stale DNS records exist", n))
+			}
+		}
+
+		p.Clusters = append(p.Clusters, cp)
+		p.Summary[cp.Action]++
+	}
+
+	sort.Slice(p.Clusters, func(i, j int) bool {
+		return p.Clusters[i].Cluster < p.Clusters[j].Cluster
+	})
+	return p, nil
+}
+
+// diffNodeGroups returns the differences between the desired and actual node groups. If the
+// provider couldn't tell, i.e. actual is nil, no differences are returned.
+func diffNodeGroups(desired, actual []config.NodeGroup) []string {
+	if actual == nil {
+		return nil
+	}
+	changes := []string{}
+	for i := 0; i < len(desired) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			changes = append(changes, fmt.Sprintf("node group %d: add %s", i+1, nodeGroupStr(desired[i])))
+		case i >= len(desired):
+			changes = append(changes, fmt.Sprintf("node group %d: remove %s", i+1, nodeGroupStr(actual[i])))
+		default:
+			// The instances of autoscaling node groups change all the time
+			if !(desired[i].Autoscales() && actual[i].Autoscales()) && desired[i].Instances != actual[i].Instances {
+				changes = append(changes, fmt.Sprintf("node group %d: instances %d -> %d", i+1, actual[i].Instances, desired[i].Instances))
+			}
+			if autoscalingStr(desired[i]) != autoscalingStr(actual[i]) {
+				changes = append(changes, fmt.Sprintf("node group %d: autoscaling %s -> %s", i+1, autoscalingStr(actual[i]), autoscalingStr(desired[i])))
+			}
+			// Nil labels or taints mean the provider can't tell them
+			if actual[i].Labels != nil && labelsStr(desired[i].Labels) != labelsStr(actual[i].Labels) {
+				changes = append(changes, fmt.Sprintf("node group %d: labels [%s] -> [%s]", i+1, labelsStr(actual[i].Labels), labelsStr(desired[i].Labels)))
+			}
+			if actual[i].Taints != nil && taintsStr(desired[i].Taints) != taintsStr(actual[i].Taints) {
+				changes = append(changes, fmt.Sprintf("node group %d: taints [%s] -> [%s]", i+1, taintsStr(actual[i].Taints), taintsStr(desired[i].Taints)))
+			}
+			// The zero NodeClaim means the provider didn't recognize the node size
+			if actual[i].NodeClaim != (config.NodeClaim{}) && !satisfies(actual[i].NodeClaim, desired[i].NodeClaim) {
+				changes = append(changes, fmt.Sprintf("node group %d: size %s -> %s", i+1, nodeClaimStr(actual[i].NodeClaim), nodeClaimStr(desired[i].NodeClaim)))
+			}
+		}
+	}
+	return changes
+}
+
+// satisfies tells whether the actual node size meets the claim. Providers choose the cheapest size
+// meeting the claim, which might be bigger than claimed.
+func satisfies(actual, claim config.NodeClaim) bool {
+	return actual.CPU >= claim.CPU && actual.RAM >= claim.RAM && (actual.Dedicated || !claim.Dedicated)
+}
+
+func nodeGroupStr(ng config.NodeGroup) string {
+	s := fmt.Sprintf("%d x %s", ng.Instances, nodeClaimStr(ng.NodeClaim))
+	if ng.Autoscales() {
+		s += fmt.Sprintf(", autoscaling %s", autoscalingStr(ng))
+	}
+	if len(ng.Labels) != 0 {
+		s += fmt.Sprintf(", labels [%s]", labelsStr(ng.Labels))
+	}
+	if len(ng.Taints) != 0 {
+		s += fmt.Sprintf(", taints [%s]", taintsStr(ng.Taints))
+	}
+	return s
+}
+
+func autoscalingStr(ng config.NodeGroup) string {
+	if !ng.Autoscales() {
+		return "off"
+	}
+	return fmt.Sprintf("%d-%d", ng.MinInstances, ng.MaxInstances)
+}
+
+// labelsStr returns the labels sorted by key, so that they can be compared
+func labelsStr(labels map[string]string) string {
+	strs := []string{}
+	for k, v := range labels {
+		strs = append(strs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, " ")
+}
+
+// taintsStr returns the taints sorted, so that they can be compared
+func taintsStr(taints []config.Taint) string {
+	strs := []string{}
+	for _, t := range taints {
+		strs = append(strs, t.String())
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, " ")
+}
+
+func nodeClaimStr(c config.NodeClaim) string {
+	if c == (config.NodeClaim{}) {
+		return "unknown size"
+	}
+	s := fmt.Sprintf("%d CPUs/%dGB RAM", c.CPU, c.RAM)
+	if c.Dedicated {
+		s += " (dedicated)"
+	}
+	return s
+}
+
+// Write writes the plan to w in the given format
+func Write(w io.Writer, p *Plan, format Format) error {
+	switch format {
+	case FormatText:
+		return writeText(w, p)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	default:
+		return fmt.Errorf("invalid plan format %q, expected one of %v", format, Formats)
+	}
+}
+
+func writeText(w io.Writer, p *Plan) error {
+	b := &strings.Builder{}
+	for _, cp := range p.Clusters {
+		fmt.Fprintf(b, "%s cluster %s (%s): %s\n", actionSymbols[cp.Action], cp.Cluster, cp.Name, cp.Action)
+		for _, change := range cp.Changes {
+			fmt.Fprintf(b, "      %s\n", change)
+		}
+	}
+	fmt.Fprintf(b, "\nPlan: %d to create, %d unchanged, %d drifted (not fixed by apply), %d excess (deleted by cleanup --excess).\n",
+		p.Summary[ActionCreate], p.Summary[ActionNoChange], p.Summary[ActionDrift], p.Summary[ActionExcess])
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,196 @@
+package byo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+const (
+	// KubeconfigsKey is a comma-separated list of kubeconfig paths. The first one is used for
+	// cluster 01, the second for cluster 02, and so on.
+	KubeconfigsKey = "kubeconfigs"
+	// KubeconfigDirKey is a directory of kubeconfig files. The files are sorted by name, and
+	// the first one is used for cluster 01, the second for cluster 02, and so on.
+	KubeconfigDirKey = "kubeconfigDir"
+)
+
+// NewBYOCloudProvider returns a provider for clusters that already exist, e.g. ones handed out
+// by the venue or a sponsor. It never creates nor deletes the clusters themselves.
+func NewBYOCloudProvider(ctx context.Context, p *config.Provider) (provider.CloudProvider, error) {
+	kubeconfigs := []string{}
+	if list, ok := p.ProviderSpecific[KubeconfigsKey]; ok {
+		for _, path := range strings.Split(list, ",") {
+			kubeconfigs = append(kubeconfigs, strings.TrimSpace(path))
+		}
+	} else if dir, ok := p.ProviderSpecific[KubeconfigDirKey]; ok {
+		fileInfos, err := ioutil.ReadDir(resolvePath(ctx, dir))
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fileInfos {
+			if fi.IsDir() {
+				continue
+			}
+			kubeconfigs = append(kubeconfigs, filepath.Join(dir, fi.Name()))
+		}
+		sort.Strings(kubeconfigs)
+	} else {
+		return nil, fmt.Errorf("the byo provider requires either %q or %q to be set in providerSpecific", KubeconfigsKey, KubeconfigDirKey)
+	}
+
+	return &BYOCloudProvider{
+		kubeconfigs: kubeconfigs,
+	}, nil
+}
+
+type BYOCloudProvider struct {
+	// kubeconfigs[0] is the kubeconfig path for cluster 01
+	kubeconfigs []string
+}
+
+// CreateCluster only makes sure the existing cluster is reachable, and returns its kubeconfig
+func (b *BYOCloudProvider) CreateCluster(ctx context.Context, m provider.ClusterMeta, c provider.ClusterSpec) (*provider.Cluster, error) {
+	logger := util.Logger(ctx)
+
+	start := time.Now().UTC()
+	cluster := &provider.Cluster{
+		ClusterMeta: m,
+		Spec:        c,
+		Status: provider.ClusterStatus{
+			ID:             m.Name(),
+			ProvisionStart: &start,
+		},
+	}
+
+	kubeconfigPath, err := b.kubeconfigPath(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig, err := ioutil.ReadFile(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	cluster.Status.KubeconfigBytes = kubeconfig
+
+	if endpoint, err := provider.KubeconfigServer(kubeconfig); err == nil {
+		cluster.Status.EndpointURL = endpoint
+		cluster.Status.EndpointIP = net.ParseIP(endpoint.Hostname())
+	}
+
+	logger.Infof("Checking that the cluster in %q is reachable", kubeconfigPath)
+	if _, _, err := util.ReadOnlyCommand(ctx, "kubectl",
+		"--kubeconfig", kubeconfigPath,
+		"get", "--raw", "/readyz",
+	).Run(); err != nil {
+		return nil, fmt.Errorf("cluster in %q isn't reachable: %w", kubeconfigPath, err)
+	}
+
+	now := time.Now().UTC()
+	cluster.Status.ProvisionDone = &now
+	return cluster, nil
+}
+
+// DeleteCluster removes everything workshopctl installed, but leaves the cluster itself alone
+func (b *BYOCloudProvider) DeleteCluster(ctx context.Context, m provider.ClusterMeta) error {
+	logger := util.Logger(ctx)
+
+	kubeconfigPath, err := b.kubeconfigPath(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Uninstalling Flux")
+	if _, _, err := util.Command(ctx, "flux",
+		"--kubeconfig", kubeconfigPath,
+		"uninstall", "--silent",
+	).WithEnv(fmt.Sprintf("PATH=%s", os.Getenv("PATH"))).Run(); err != nil {
+		return err
+	}
+
+	// Delete the generated manifests, as they might contain cluster-scoped objects too
+	manifests, err := filepath.Glob(util.JoinPaths(ctx, m.Index.ClusterDir(), "*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, manifest := range manifests {
+		logger.Infof("Deleting the objects in %s", manifest)
+		if _, _, err := util.Command(ctx, "kubectl",
+			"--kubeconfig", kubeconfigPath,
+			"delete", "--ignore-not-found", "-f", manifest,
+		).Run(); err != nil {
+			return err
+		}
+	}
+
+	logger.Infof("Deleting the %s Namespace", constants.WorkshopctlNamespace)
+	_, _, err = util.Command(ctx, "kubectl",
+		"--kubeconfig", kubeconfigPath,
+		"delete", "namespace", constants.WorkshopctlNamespace, "--ignore-not-found",
+	).Run()
+	return err
+}
+
+func (b *BYOCloudProvider) GetKubeconfig(ctx context.Context, m provider.ClusterMeta) ([]byte, error) {
+	kubeconfigPath, err := b.kubeconfigPath(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(kubeconfigPath)
+}
+
+// ResolveVersion returns version as-is, as the clusters already exist and run whatever version
+// they were created with
+func (b *BYOCloudProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	return version, nil
+}
+
+// ListClusters returns the clusters apply has taken over, i.e. the ones whose kubeconfig it has
+// copied into the cluster directory. The others are left out, so that apply runs CreateCluster for
+// them, which checks that they are reachable.
+func (b *BYOCloudProvider) ListClusters(ctx context.Context, namePrefix string) ([]*provider.Cluster, error) {
+	clusters := make([]*provider.Cluster, 0, len(b.kubeconfigs))
+	for i := range b.kubeconfigs {
+		m := provider.ClusterMeta{
+			NamePrefix: namePrefix,
+			Index:      config.ClusterNumber(i + 1),
+		}
+		if !util.FileExists(util.JoinPaths(ctx, m.Index.KubeConfigPath())) {
+			continue
+		}
+		clusters = append(clusters, &provider.Cluster{
+			ClusterMeta: m,
+			Status: provider.ClusterStatus{
+				ID: m.Name(),
+			},
+		})
+	}
+	return clusters, nil
+}
+
+func (b *BYOCloudProvider) kubeconfigPath(ctx context.Context, m provider.ClusterMeta) (string, error) {
+	i := int(m.Index) - 1
+	if i < 0 || i >= len(b.kubeconfigs) {
+		return "", fmt.Errorf("no kubeconfig given for cluster %s, only %d kubeconfigs are available", m.Index, len(b.kubeconfigs))
+	}
+	return resolvePath(ctx, b.kubeconfigs[i]), nil
+}
+
+// resolvePath makes relative paths relative to the root directory
+func resolvePath(ctx context.Context, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return util.JoinPaths(ctx, path)
+}
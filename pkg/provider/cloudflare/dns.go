@@ -0,0 +1,161 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/gen"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	cf "github.com/cloudflare/cloudflare-go"
+	"github.com/sirupsen/logrus"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// NewCloudflareDNSProvider returns a DNS provider for zones hosted on Cloudflare. The service
+// account must be an API token with the Zone:Read and DNS:Edit permissions for the root domain.
+func NewCloudflareDNSProvider(ctx context.Context, p *config.Provider, rootDomain string) (provider.DNSProvider, error) {
+	api, err := cf.NewWithAPIToken(p.ServiceAccountContent)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudflareDNSProvider{
+		api:        api,
+		rootDomain: rootDomain,
+		dryRun:     util.IsDryRun(ctx),
+	}, nil
+}
+
+type CloudflareDNSProvider struct {
+	api        *cf.API
+	rootDomain string
+	dryRun     bool
+}
+
+func (c *CloudflareDNSProvider) ChartProcessors() []gen.Processor {
+	return []gen.Processor{&provider.DNSEnvProcessor{
+		TraefikEnv:     traefikDNSEnvValue,
+		ExternalDNSEnv: externalDNSEnvValue,
+	}}
+}
+
+func (c *CloudflareDNSProvider) ValuesProcessors() []gen.Processor {
+	return nil
+}
+
+// EnsureZone makes sure the root domain is a zone managed by Cloudflare. The zone is never
+// created, as that also requires changing the NS records at the registrar.
+func (c *CloudflareDNSProvider) EnsureZone(ctx context.Context) error {
+	logger := util.Logger(ctx)
+
+	logger.Debugf("Ensuring domain %s is managed by Cloudflare DNS", c.rootDomain)
+	zoneID, err := c.zoneID()
+	if err != nil {
+		return err
+	}
+	zone, err := c.api.ZoneDetails(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+	util.DebugObject(ctx, "Zone exists", zone)
+	return nil
+}
+
+// ListRecords returns the records under the cluster domain
+func (c *CloudflareDNSProvider) ListRecords(ctx context.Context, m provider.ClusterMeta) ([]provider.DNSRecord, error) {
+	logger := util.Logger(ctx)
+
+	zoneID, err := c.zoneID()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterDomain := m.Index.Domain(c.rootDomain)
+	logger.Debugf("Listing the records of zone %s under %s", c.rootDomain, clusterDomain)
+	cfRecords, err := c.api.DNSRecords(ctx, zoneID, cf.DNSRecord{})
+	if err != nil {
+		return nil, err
+	}
+
+	records := []provider.DNSRecord{}
+	for _, record := range cfRecords {
+		logger.Debugf("Observed record: %s %s", record.Type, record.Name)
+		if !provider.RecordBelongsTo(record.Name, clusterDomain) {
+			continue
+		}
+		records = append(records, provider.DNSRecord{
+			Name:         record.Name,
+			Type:         record.Type,
+			Data:         record.Content,
+			ProviderData: record,
+		})
+	}
+	return records, nil
+}
+
+func (c *CloudflareDNSProvider) CleanupRecords(ctx context.Context, m provider.ClusterMeta) error {
+	logger := util.Logger(ctx)
+
+	records, err := c.ListRecords(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	clusterDomain := m.Index.Domain(c.rootDomain)
+	if util.IsForce(ctx) {
+		logger.Warnf("Deleting all records under %s, also those not created by external-dns", clusterDomain)
+	} else {
+		records = provider.OwnedRecords(records, clusterDomain)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	zoneID, err := c.zoneID()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := c.deleteRecord(ctx, zoneID, r.ProviderData.(cf.DNSRecord), logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CloudflareDNSProvider) zoneID() (string, error) {
+	zoneID, err := c.api.ZoneIDByName(c.rootDomain)
+	if err != nil {
+		return "", fmt.Errorf("couldn't find Cloudflare zone for %s: %w", c.rootDomain, err)
+	}
+	return zoneID, nil
+}
+
+func (c *CloudflareDNSProvider) deleteRecord(ctx context.Context, zoneID string, record cf.DNSRecord, logger *logrus.Entry) error {
+	recordStr := fmt.Sprintf("%s %s: %s", record.Type, record.Name, record.Content)
+	if c.dryRun {
+		logger.Infof("Would delete record: %s", recordStr)
+		return nil
+	}
+	logger.Infof("Deleting record: %s", recordStr)
+	return c.api.DeleteDNSRecord(ctx, zoneID, record.ID)
+}
+
+var (
+	externalDNSEnvValue = kyaml.MustParse(`
+- name: CF_API_TOKEN
+  valueFrom:
+    secretKeyRef:
+      name: workshopctl
+      key: DNS_PROVIDER_SERVICEACCOUNT
+`)
+
+	// Traefik (through lego) reads the token from a differently named variable than external-dns
+	traefikDNSEnvValue = kyaml.MustParse(`
+- name: CF_DNS_API_TOKEN
+  valueFrom:
+    secretKeyRef:
+      name: workshopctl
+      key: DNS_PROVIDER_SERVICEACCOUNT
+`)
+)
@@ -0,0 +1,244 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	cf "github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	testRootDomain = "example.com"
+	testZoneID     = "023e105f4ecef8ad9ca31a8372d0c353"
+	// ownershipData is the TXT registry record external-dns creates next to its records
+	ownershipData = `"heritage=external-dns,external-dns/owner=workshopctl,external-dns/resource=ingress/workshopctl/traefik"`
+)
+
+// fakeCloudflare is a minimal in-memory stand-in for the Cloudflare API, serving one zone. DNS
+// records are listed pageSize at a time, to exercise pagination.
+type fakeCloudflare struct {
+	mu       sync.Mutex
+	zone     string
+	records  []cf.DNSRecord
+	pageSize int
+	// pages records the pages of DNS records that were requested
+	pages   []int
+	deleted []string
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{"success": false})
+		return
+	}
+
+	recordsPath := "/zones/" + testZoneID + "/dns_records"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/zones":
+		zones := []cf.Zone{}
+		if len(f.zone) != 0 && r.URL.Query().Get("name") == f.zone {
+			zones = append(zones, cf.Zone{ID: testZoneID, Name: f.zone})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":     true,
+			"result":      zones,
+			"result_info": cf.ResultInfo{Page: 1, TotalPages: 1, Count: len(zones), Total: len(zones)},
+		})
+
+	case r.Method == http.MethodGet && r.URL.Path == "/zones/"+testZoneID:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"result":  cf.Zone{ID: testZoneID, Name: f.zone},
+		})
+
+	case r.Method == http.MethodGet && r.URL.Path == recordsPath:
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+		f.pages = append(f.pages, page)
+		start := (page - 1) * f.pageSize
+		if start > len(f.records) {
+			start = len(f.records)
+		}
+		end := start + f.pageSize
+		if end > len(f.records) {
+			end = len(f.records)
+		}
+		totalPages := (len(f.records) + f.pageSize - 1) / f.pageSize
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":     true,
+			"result":      f.records[start:end],
+			"result_info": cf.ResultInfo{Page: page, PerPage: f.pageSize, TotalPages: totalPages, Count: end - start, Total: len(f.records)},
+		})
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, recordsPath+"/"):
+		id := strings.TrimPrefix(r.URL.Path, recordsPath+"/")
+		for i, record := range f.records {
+			if record.ID == id {
+				f.records = append(f.records[:i], f.records[i+1:]...)
+				f.deleted = append(f.deleted, id)
+				writeJSON(w, http.StatusOK, map[string]interface{}{
+					"success": true,
+					"result":  map[string]string{"id": id},
+				})
+				return
+			}
+		}
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"success": false})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// names returns the "<type> <name>" of the remaining records
+func (f *fakeCloudflare) names() []string {
+	names := []string{}
+	for _, record := range f.records {
+		names = append(names, record.Type+" "+record.Name)
+	}
+	return names
+}
+
+// add adds a record with a unique ID to the zone
+func (f *fakeCloudflare) add(typ, name, content string) {
+	f.records = append(f.records, cf.DNSRecord{
+		ID:      fmt.Sprintf("record-%d", len(f.records)+1),
+		Type:    typ,
+		Name:    name,
+		Content: content,
+		TTL:     1,
+	})
+}
+
+// addOwned adds an A record and its TXT registry record, as external-dns creates them
+func (f *fakeCloudflare) addOwned(name, ip string) {
+	f.add("A", name, ip)
+	f.add("TXT", name, ownershipData)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func newTestProvider(t *testing.T, ctx context.Context, f *fakeCloudflare) *CloudflareDNSProvider {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	// The default rate limit of 4 requests per second would only slow down the tests
+	api, err := cf.NewWithAPIToken("test-token", cf.BaseURL(srv.URL), cf.UsingRateLimit(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CloudflareDNSProvider{
+		api:        api,
+		rootDomain: testRootDomain,
+		dryRun:     util.IsDryRun(ctx),
+	}
+}
+
+func TestEnsureZone(t *testing.T) {
+	ctx := util.WithDryRun(context.Background(), false)
+
+	if err := newTestProvider(t, ctx, &fakeCloudflare{zone: testRootDomain}).EnsureZone(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The zone is never created
+	if err := newTestProvider(t, ctx, &fakeCloudflare{}).EnsureZone(ctx); err == nil {
+		t.Error("expected an error when the zone doesn't exist")
+	}
+}
+
+func TestListRecords(t *testing.T) {
+	ctx := util.WithDryRun(context.Background(), false)
+	f := &fakeCloudflare{zone: testRootDomain, pageSize: 3}
+	f.add("NS", testRootDomain, "ns1.cloudflare.com")
+	f.addOwned("*.cluster-01.example.com", "10.0.0.1")
+	f.addOwned("cluster-01.example.com", "10.0.0.1")
+	f.addOwned("cluster-011.example.com", "10.0.0.11")
+	f.addOwned("cluster-02.example.com", "10.0.0.2")
+
+	records, err := newTestProvider(t, ctx, f).ListRecords(ctx, provider.ClusterMeta{Index: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range records {
+		got = append(got, r.Type+" "+r.Name)
+	}
+	want := []string{
+		"A *.cluster-01.example.com",
+		"TXT *.cluster-01.example.com",
+		"A cluster-01.example.com",
+		"TXT cluster-01.example.com",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v, got %v", want, got)
+	}
+	if len(f.pages) != 3 || f.pages[2] != 3 {
+		t.Errorf("expected all 3 pages of records to be listed, got pages %v", f.pages)
+	}
+}
+
+func TestCleanupRecords(t *testing.T) {
+	ctx := util.WithDryRun(context.Background(), false)
+	f := &fakeCloudflare{zone: testRootDomain, pageSize: 4}
+	f.add("NS", testRootDomain, "ns1.cloudflare.com")
+	f.addOwned("*.cluster-01.example.com", "10.0.0.1")
+	f.addOwned("cluster-01.example.com", "10.0.0.1")
+	f.addOwned("cluster-011.example.com", "10.0.0.11")
+	f.addOwned("cluster-02.example.com", "10.0.0.2")
+	// A record in the cluster domain that external-dns didn't create
+	f.add("A", "manual.cluster-01.example.com", "10.0.0.100")
+
+	// Nothing is deleted when dry-running
+	dryRunCtx := util.WithDryRun(context.Background(), true)
+	if err := newTestProvider(t, dryRunCtx, f).CleanupRecords(dryRunCtx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.deleted) != 0 {
+		t.Fatalf("expected no records to be deleted when dry-running, got %v", f.deleted)
+	}
+
+	if err := newTestProvider(t, ctx, f).CleanupRecords(ctx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"NS example.com",
+		"A cluster-011.example.com",
+		"TXT cluster-011.example.com",
+		"A cluster-02.example.com",
+		"TXT cluster-02.example.com",
+		"A manual.cluster-01.example.com",
+	}
+	if got := f.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v to be kept, got %v", want, got)
+	}
+
+	// When forced, also records not created by external-dns are deleted
+	forceCtx := util.WithForce(ctx, true)
+	if err := newTestProvider(t, forceCtx, f).CleanupRecords(forceCtx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	want = want[:len(want)-1]
+	if got := f.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v to be kept when forced, got %v", want, got)
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloud-native-nordics/workshopctl/pkg/config"
@@ -16,6 +19,7 @@ import (
 	"github.com/digitalocean/godo"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
 )
 
 var clusterNotFound = fmt.Errorf("couldn't find cluster by name")
@@ -33,6 +37,8 @@ type doCommon struct {
 }
 
 func initCommon(ctx context.Context, p *config.Provider) doCommon {
+	// All clients share the same transport, and hence the same rate limit
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: sharedTransport})
 	oauthClient := oauth2.NewClient(ctx, p.TokenSource())
 	return doCommon{
 		p:      p,
@@ -41,6 +47,28 @@ func initCommon(ctx context.Context, p *config.Provider) doCommon {
 	}
 }
 
+// listPageSize is the maximum amount of items per page the DigitalOcean API allows
+const listPageSize = 200
+
+// listAll calls list for every page, until the last page has been read
+func listAll(list func(opt *godo.ListOptions) (*godo.Response, error)) error {
+	opt := &godo.ListOptions{PerPage: listPageSize}
+	for {
+		resp, err := list(opt)
+		if err != nil {
+			return err
+		}
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			return nil
+		}
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return err
+		}
+		opt.Page = page + 1
+	}
+}
+
 func NewDigitalOceanCloudProvider(ctx context.Context, p *config.Provider) (provider.CloudProvider, error) {
 	doProvider := &DigitalOceanCloudProvider{
 		doCommon: initCommon(ctx, p),
@@ -57,25 +85,10 @@ type DigitalOceanCloudProvider struct {
 	doCommon
 
 	region string
-}
 
-func chooseSize(c config.NodeClaim) string {
-	// TODO: Improve this to first check ratio between CPU and memory to distinguish
-	// what kind of type of droplet there should be (2 * CPU = RAM e.g. for Basic and CPU-optimized
-	// droplets, 4 for General Purpose, and 8 for Mem-optimized).
-	m := map[config.NodeClaim]string{
-		{CPU: 2, RAM: 2, Dedicated: false}:  "s-2vcpu-2gb",  // $15
-		{CPU: 2, RAM: 4, Dedicated: false}:  "s-2vcpu-4gb",  // $20
-		{CPU: 4, RAM: 8, Dedicated: false}:  "s-4vcpu-8gb",  // $40
-		{CPU: 8, RAM: 16, Dedicated: false}: "s-8vcpu-16gb", // $80
-		{CPU: 2, RAM: 4, Dedicated: true}:   "c-2",          // $40
-		{CPU: 4, RAM: 8, Dedicated: true}:   "c-4",          // $80
-	}
-	if str, ok := m[c]; ok {
-		return str
-	}
-	log.Warnf("didn't find a good size for you, fallback to s-2vcpu-4gb")
-	return "s-2vcpu-4gb"
+	// sizes caches the size catalog, see sizeCatalog
+	sizes    []godo.Size
+	sizesMux sync.Mutex
 }
 
 func (do *DigitalOceanCloudProvider) CreateCluster(ctx context.Context, m provider.ClusterMeta, c provider.ClusterSpec) (*provider.Cluster, error) {
@@ -90,18 +103,30 @@ func (do *DigitalOceanCloudProvider) CreateCluster(ctx context.Context, m provid
 		},
 	}
 
+	sizes, err := do.sizeCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// For now we only have one nodepool, hence we hard-code this to 01
 	nodePools := []*godo.KubernetesNodePoolCreateRequest{}
 	for i, ng := range c.NodeGroups {
-		// This starts from 01, and always is padded to two digits like the cluster number
-		idx := config.ClusterNumber(i + 1)
-		nodePoolName := fmt.Sprintf("%s-nodepool-%s", cluster.Name(), idx)
+		nodePoolName := nodePoolName(cluster.Name(), i)
+		size, err := chooseSize(sizes, do.region, ng.NodeClaim)
+		if err != nil {
+			return nil, fmt.Errorf("node group %d: %w", i+1, err)
+		}
+		logger.Debugf("Chose size %s for node group %d", size.Slug, i+1)
 		nodePools = append(nodePools, &godo.KubernetesNodePoolCreateRequest{
 			Name: nodePoolName,
 
-			Size:      chooseSize(ng.NodeClaim),
+			Size:      size.Slug,
 			Count:     int(ng.Instances),
-			AutoScale: false,
+			AutoScale: ng.Autoscales(),
+			MinNodes:  int(ng.MinInstances),
+			MaxNodes:  int(ng.MaxInstances),
+			Labels:    ng.Labels,
+			Taints:    toDOTaints(ng.Taints),
 			Tags: []string{
 				WorkshopctlTag,
 				nodePoolName,
@@ -113,7 +138,7 @@ func (do *DigitalOceanCloudProvider) CreateCluster(ctx context.Context, m provid
 	req := &godo.KubernetesClusterCreateRequest{
 		Name:        cluster.Name(),
 		RegionSlug:  do.region,
-		VersionSlug: cluster.Spec.Version, // TODO: Resolve c.Version correctly
+		VersionSlug: cluster.Spec.Version,
 		Tags: []string{
 			WorkshopctlTag,
 			cluster.Name(),
@@ -121,6 +146,12 @@ func (do *DigitalOceanCloudProvider) CreateCluster(ctx context.Context, m provid
 		NodePools:   nodePools,
 		AutoUpgrade: false,
 	}
+	if c.ExpiresAt != nil {
+		req.Tags = append(req.Tags, expiryTag(*c.ExpiresAt))
+	}
+	if len(c.RootDomain) != 0 {
+		req.Tags = append(req.Tags, fmt.Sprintf("%s:%s", provider.RootDomainKey, c.RootDomain))
+	}
 
 	if do.dryRun || log.IsLevelEnabled(log.DebugLevel) {
 		b, _ := json.Marshal(req)
@@ -131,7 +162,6 @@ func (do *DigitalOceanCloudProvider) CreateCluster(ctx context.Context, m provid
 		}
 		log.Debugf("Would send this request to DO: %s", string(b))
 	}
-	// TODO: Rate limiting
 	doCluster, err := do.getClusterByName(ctx, cluster.Name())
 	if err == nil {
 		// If the cluster was found, just note it's ID
@@ -207,20 +237,214 @@ func (do *DigitalOceanCloudProvider) DeleteCluster(ctx context.Context, m provid
 	}
 	util.DebugObject(ctx, "LBs", lbs)
 
+	// List the volumes before the cluster is gone, as they're partly found through its PVs
+	volumes, err := do.listVolumesForCluster(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	util.DebugObject(ctx, "Volumes", volumes)
+
 	for _, lb := range lbs {
 		if err := do.deleteLB(ctx, lb); err != nil {
 			return err
 		}
 	}
 
-	return do.deleteCluster(ctx, cluster)
+	if err := do.deleteCluster(ctx, cluster); err != nil {
+		return err
+	}
+	// The volumes are detached when the nodes are deleted along with the cluster
+	return do.deleteVolumes(ctx, volumes)
 }
 
-func (do *DigitalOceanCloudProvider) getClusterByName(ctx context.Context, name string) (*godo.KubernetesCluster, error) {
+func (do *DigitalOceanCloudProvider) GetKubeconfig(ctx context.Context, m provider.ClusterMeta) ([]byte, error) {
+	cluster, err := do.getClusterByName(ctx, m.Name())
+	if err != nil {
+		return nil, err
+	}
+	cc, _, err := do.c.Kubernetes.GetKubeConfig(ctx, cluster.ID)
+	if err != nil {
+		return nil, err
+	}
+	return cc.KubeconfigYAML, nil
+}
+
+// ResolveVersion returns the slug of the newest version DigitalOcean offers that matches version
+func (do *DigitalOceanCloudProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	opts, _, err := do.c.Kubernetes.GetOptions(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var newest *godo.KubernetesVersion
+	var newestVersion *utilversion.Version
+	slugs := make([]string, 0, len(opts.Versions))
+	for _, v := range opts.Versions {
+		slugs = append(slugs, v.Slug)
+		if v.Slug == version {
+			return v.Slug, nil
+		}
+		if !versionMatches(version, v.KubernetesVersion) {
+			continue
+		}
+		parsed, err := utilversion.ParseGeneric(v.KubernetesVersion)
+		if err != nil {
+			log.Debugf("Ignoring unparseable Kubernetes version %q: %v", v.KubernetesVersion, err)
+			continue
+		}
+		if newestVersion == nil || newestVersion.LessThan(parsed) {
+			newest, newestVersion = v, parsed
+		}
+	}
+	if newest == nil {
+		return "", fmt.Errorf("Kubernetes version %q isn't available on DigitalOcean, available versions are %s, %s",
+			version, config.LatestKubernetesVersion, strings.Join(slugs, ", "))
+	}
+	return newest.Slug, nil
+}
+
+// versionMatches tells whether the exact Kubernetes version, e.g. "1.29.1", matches the requested
+// one, e.g. "latest", "1.29" or "1.29.1"
+func versionMatches(requested, exact string) bool {
+	requested = strings.TrimPrefix(requested, "v")
+	return requested == config.LatestKubernetesVersion || requested == exact || strings.HasPrefix(exact, requested+".")
+}
+
+func (do *DigitalOceanCloudProvider) ListClusters(ctx context.Context, namePrefix string) ([]*provider.Cluster, error) {
+	clusters, err := do.listClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := do.sizeCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*provider.Cluster{}
+	for _, kcluster := range clusters {
+		m, ok := provider.ParseClusterName(namePrefix, kcluster.Name)
+		if !ok {
+			continue
+		}
+		cluster := &provider.Cluster{
+			ClusterMeta: m,
+			Spec: provider.ClusterSpec{
+				Version:    kcluster.VersionSlug,
+				NodeGroups: []config.NodeGroup{},
+			},
+			Status: provider.ClusterStatus{
+				ID:         kcluster.ID,
+				EndpointIP: net.ParseIP(kcluster.IPv4),
+			},
+		}
+		cluster.Status.EndpointURL, _ = url.Parse(kcluster.Endpoint)
+		cluster.Spec.ExpiresAt = parseExpiryTag(kcluster.Tags)
+		for _, tag := range kcluster.Tags {
+			if value := strings.TrimPrefix(tag, provider.RootDomainKey+":"); value != tag {
+				cluster.Spec.RootDomain = value
+			}
+		}
+		for _, nodePool := range kcluster.NodePools {
+			ng := config.NodeGroup{
+				Instances: uint16(nodePool.Count),
+				NodeClaim: claimForSize(sizes, nodePool.Size),
+				Labels:    map[string]string{},
+				Taints:    fromDOTaints(nodePool.Taints),
+			}
+			if nodePool.AutoScale {
+				ng.MinInstances = uint16(nodePool.MinNodes)
+				ng.MaxInstances = uint16(nodePool.MaxNodes)
+			}
+			for k, v := range nodePool.Labels {
+				ng.Labels[k] = v
+			}
+			cluster.Spec.NodeGroups = append(cluster.Spec.NodeGroups, ng)
+		}
+		result = append(result, cluster)
+	}
+	return result, nil
+}
+
+// listClusters returns all Kubernetes clusters created by workshopctl. The API can't filter
+// clusters by tag, hence that is done here.
+func (do *DigitalOceanCloudProvider) listClusters(ctx context.Context) ([]*godo.KubernetesCluster, error) {
 	logger := util.Logger(ctx)
 
 	logger.Debug("Listing Kubernetes clusters...")
-	clusters, _, err := do.c.Kubernetes.List(ctx, &godo.ListOptions{})
+	clusters := []*godo.KubernetesCluster{}
+	err := listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.Kubernetes.List(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range page {
+			if !hasTag(cluster.Tags, WorkshopctlTag) {
+				logger.Debugf("Cluster %s isn't tagged with %s", cluster.Name, WorkshopctlTag)
+				continue
+			}
+			clusters = append(clusters, cluster)
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+// expiryTag returns the tag the cluster is stamped with when it expires. Tags can't contain equal
+// signs, hence the key and value are separated by a colon.
+func expiryTag(t time.Time) string {
+	return fmt.Sprintf("%s:%s", provider.ExpiresAtKey, provider.FormatExpiry(t))
+}
+
+// parseExpiryTag returns when the cluster expires, or nil if there's no valid expiry tag
+func parseExpiryTag(tags []string) *time.Time {
+	for _, tag := range tags {
+		if value := strings.TrimPrefix(tag, provider.ExpiresAtKey+":"); value != tag {
+			if t, ok := provider.ParseExpiry(value); ok {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func toDOTaints(taints []config.Taint) []godo.Taint {
+	result := []godo.Taint{}
+	for _, t := range taints {
+		result = append(result, godo.Taint{Key: t.Key, Value: t.Value, Effect: t.Effect})
+	}
+	return result
+}
+
+func fromDOTaints(taints []godo.Taint) []config.Taint {
+	result := []config.Taint{}
+	for _, t := range taints {
+		result = append(result, config.Taint{Key: t.Key, Value: t.Value, Effect: t.Effect})
+	}
+	return result
+}
+
+// nodePoolName returns the name of the node pool of the i-th node group. The number starts from 01,
+// and always is padded to two digits like the cluster number.
+func nodePoolName(clusterName string, i int) string {
+	return fmt.Sprintf("%s-nodepool-%s", clusterName, config.ClusterNumber(i+1))
+}
+
+func (do *DigitalOceanCloudProvider) getClusterByName(ctx context.Context, name string) (*godo.KubernetesCluster, error) {
+	logger := util.Logger(ctx)
+
+	clusters, err := do.listClusters(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -261,15 +485,24 @@ func (do *DigitalOceanCloudProvider) listLBsForCluster(ctx context.Context, clus
 		}
 	}
 
-	lbs, _, err := do.c.LoadBalancers.List(ctx, &godo.ListOptions{})
+	lbs := []godo.LoadBalancer{}
+	err := listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.LoadBalancers.List(ctx, opt)
+		lbs = append(lbs, page...)
+		return resp, err
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	clusterLBs := []godo.LoadBalancer{}
 	for _, lb := range lbs {
+		// LBs are tagged with the cluster ID, which still matches after the nodes have been replaced
+		found := hasTag(lb.Tags, clusterIDTag(cluster.ID))
+		if found {
+			logger.Debugf("LB %s is tagged with the ID of the cluster", lb.Name)
+		}
 		// Is there any droplet in our current cluster that is served by this LB?
-		found := false
 		for _, lbDropletID := range lb.DropletIDs {
 			// lbDropletID is an int but the same droplet IDs above are strings, hence cast this to a string
 			lbDropletIDStr := strconv.Itoa(lbDropletID)
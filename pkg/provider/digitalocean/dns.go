@@ -3,13 +3,10 @@ package digitalocean
 import (
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 
 	"github.com/cloud-native-nordics/workshopctl/pkg/config"
-	"github.com/cloud-native-nordics/workshopctl/pkg/config/keyval"
-	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
 	"github.com/cloud-native-nordics/workshopctl/pkg/gen"
 	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
 	"github.com/cloud-native-nordics/workshopctl/pkg/util"
@@ -36,7 +33,10 @@ type DigitalOceanDNSProvider struct {
 }
 
 func (do *DigitalOceanDNSProvider) ChartProcessors() []gen.Processor {
-	return []gen.Processor{&dnsProcessor{}}
+	return []gen.Processor{&provider.DNSEnvProcessor{
+		TraefikEnv:     traefikDNSEnvValue,
+		ExternalDNSEnv: externalDNSEnvValue,
+	}}
 }
 
 func (do *DigitalOceanDNSProvider) ValuesProcessors() []gen.Processor {
@@ -88,34 +88,76 @@ func (do *DigitalOceanDNSProvider) createDomain(ctx context.Context, rootDomain
 	return err
 }
 
-func (do *DigitalOceanDNSProvider) CleanupRecords(ctx context.Context, m provider.ClusterMeta) error {
+// ListRecords returns the records under the cluster domain
+func (do *DigitalOceanDNSProvider) ListRecords(ctx context.Context, m provider.ClusterMeta) ([]provider.DNSRecord, error) {
 	logger := util.Logger(ctx)
 
-	subdomain := m.Index.Subdomain()
-	logger.Debugf("Asking for records for domain %s and sub-domain %s", do.rootDomain, subdomain)
+	clusterDomain := m.Index.Domain(do.rootDomain)
+	logger.Debugf("Asking for records for domain %s and cluster domain %s", do.rootDomain, clusterDomain)
 	// List all records for domain
-	records, _, err := do.c.Domains.Records(ctx, do.rootDomain, &godo.ListOptions{})
+	domainRecords := []godo.DomainRecord{}
+	err := listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.Domains.Records(ctx, do.rootDomain, opt)
+		domainRecords = append(domainRecords, page...)
+		return resp, err
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, record := range records {
-		logger.Debugf("Observed record: %s", record)
-		// Skip records that aren't associated with the given subdomain
-		// TODO: Maybe be even more restrictive/specific about what to delete
-		// e.g. look at heritage=external-dns fields, or only delete A/TXT records.
-		if !strings.HasSuffix(record.Name, subdomain) {
-			logger.Debugf("Skipped record: %s", record)
+	records := []provider.DNSRecord{}
+	for i := range domainRecords {
+		record := &domainRecords[i]
+		logger.Debugf("Observed record: %s", do.recordStr(record))
+		// Skip records that aren't associated with the given cluster
+		if !provider.RecordBelongsTo(do.recordFQDN(record), clusterDomain) {
 			continue
 		}
-		// Delete records that are related to this subdomain
-		if err := do.deleteRecord(ctx, &record, logger); err != nil {
+		records = append(records, provider.DNSRecord{
+			Name:         do.recordFQDN(record),
+			Type:         record.Type,
+			Data:         record.Data,
+			ProviderData: record,
+		})
+	}
+	return records, nil
+}
+
+// CleanupRecords deletes the records external-dns has created for the cluster, as proven by
+// its TXT registry records. When forced, all records under the cluster domain are deleted.
+func (do *DigitalOceanDNSProvider) CleanupRecords(ctx context.Context, m provider.ClusterMeta) error {
+	logger := util.Logger(ctx)
+
+	records, err := do.ListRecords(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	clusterDomain := m.Index.Domain(do.rootDomain)
+	if util.IsForce(ctx) {
+		logger.Warnf("Deleting all records under %s, also those not created by external-dns", clusterDomain)
+	} else {
+		records = provider.OwnedRecords(records, clusterDomain)
+	}
+
+	for _, r := range records {
+		// Delete records that are related to this cluster
+		if err := do.deleteRecord(ctx, r.ProviderData.(*godo.DomainRecord), logger); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// recordFQDN returns the fully-qualified name of the record, which DigitalOcean stores
+// relative to the domain, with "@" meaning the domain itself
+func (do *DigitalOceanDNSProvider) recordFQDN(record *godo.DomainRecord) string {
+	if record.Name == "@" {
+		return do.rootDomain
+	}
+	return fmt.Sprintf("%s.%s", record.Name, do.rootDomain)
+}
+
 func (do *DigitalOceanDNSProvider) deleteRecord(ctx context.Context, record *godo.DomainRecord, logger *logrus.Entry) error {
 	recordStr := do.recordStr(record)
 	if do.dryRun {
@@ -128,7 +170,7 @@ func (do *DigitalOceanDNSProvider) deleteRecord(ctx context.Context, record *god
 }
 
 func (do *DigitalOceanDNSProvider) recordStr(record *godo.DomainRecord) string {
-	return fmt.Sprintf("%s %s.%s: %s", record.Type, record.Name, do.rootDomain, record.Data)
+	return fmt.Sprintf("%s %s: %s", record.Type, do.recordFQDN(record), record.Data)
 }
 
 var (
@@ -148,31 +190,3 @@ var (
       key: DNS_PROVIDER_SERVICEACCOUNT
 `)
 )
-
-type dnsProcessor struct{}
-
-func (pr *dnsProcessor) Process(ctx context.Context, cd *gen.ChartData, p *keyval.Parameters, r io.Reader, w io.Writer) error {
-	return util.KYAMLFilter(r, w, util.KYAMLFilterFunc(
-		func(node *kyaml.RNode) (*kyaml.RNode, error) {
-			return node, util.KYAMLResourceMetaMatcher(node, util.KYAMLResourceMetaMatch{
-				Kind:      "Deployment",
-				Name:      "traefik",
-				Namespace: constants.WorkshopctlNamespace,
-				Func: func() error {
-					return node.PipeE(
-						kyaml.LookupCreate(kyaml.SequenceNode, "spec", "template", "spec", "containers", "[name=traefik]", "env"),
-						kyaml.Append(traefikDNSEnvValue.YNode().Content...))
-				},
-			}, util.KYAMLResourceMetaMatch{
-				Kind:      "Deployment",
-				Name:      "external-dns",
-				Namespace: constants.WorkshopctlNamespace,
-				Func: func() error {
-					return node.PipeE(
-						kyaml.LookupCreate(kyaml.SequenceNode, "spec", "template", "spec", "containers", "[name=external-dns]", "env"),
-						kyaml.Append(externalDNSEnvValue.YNode().Content...))
-				},
-			})
-		},
-	))
-}
@@ -0,0 +1,116 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/digitalocean/godo"
+)
+
+// minNodePoolCount is the least amount of nodes a node pool can be scaled down to, as DOKS
+// requires fixed-size node pools to have at least one node
+const minNodePoolCount = 1
+
+// nodeStateRunning is the state of a node that has joined the cluster
+const nodeStateRunning = "running"
+
+// Hibernate scales each node pool of the cluster down to one node, and turns off autoscaling. The
+// control plane, and hence the state of the cluster, is kept.
+func (do *DigitalOceanCloudProvider) Hibernate(ctx context.Context, m provider.ClusterMeta) error {
+	cluster, err := do.getClusterByName(ctx, m.Name())
+	if err != nil {
+		return err
+	}
+	for _, nodePool := range cluster.NodePools {
+		if err := do.scaleNodePool(ctx, cluster, nodePool, config.NodeGroup{Instances: minNodePoolCount}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resume scales the node pools back up to the instances of their node groups, turns autoscaling
+// back on for the node groups that autoscale, and waits for the nodes to be running
+func (do *DigitalOceanCloudProvider) Resume(ctx context.Context, m provider.ClusterMeta, c provider.ClusterSpec) error {
+	logger := util.Logger(ctx)
+
+	cluster, err := do.getClusterByName(ctx, m.Name())
+	if err != nil {
+		return err
+	}
+	nodePools := map[string]*godo.KubernetesNodePool{}
+	for _, nodePool := range cluster.NodePools {
+		nodePools[nodePool.Name] = nodePool
+	}
+	for i, ng := range c.NodeGroups {
+		nodePool, ok := nodePools[nodePoolName(cluster.Name, i)]
+		if !ok {
+			return fmt.Errorf("node group %d has no node pool %s, run apply to create it", i+1, nodePoolName(cluster.Name, i))
+		}
+		if err := do.scaleNodePool(ctx, cluster, nodePool, ng); err != nil {
+			return err
+		}
+	}
+
+	if util.IsDryRun(ctx) {
+		logger.Infof("Would wait for the nodes of cluster %s to be running", cluster.Name)
+		return nil
+	}
+	logger.Infof("Waiting for the nodes of cluster %s to be running", cluster.Name)
+	return util.Poll(ctx, nil, func() (bool, error) {
+		kcluster, _, err := do.c.Kubernetes.Get(ctx, cluster.ID)
+		if err != nil {
+			return false, fmt.Errorf("getting a kubernetes cluster failed: %v", err)
+		}
+		for i, ng := range c.NodeGroups {
+			for _, nodePool := range kcluster.NodePools {
+				if nodePool.Name != nodePoolName(cluster.Name, i) {
+					continue
+				}
+				running := 0
+				for _, node := range nodePool.Nodes {
+					if node.Status != nil && node.Status.State == nodeStateRunning {
+						running++
+					}
+				}
+				if running < int(ng.Instances) {
+					return false, fmt.Errorf("%d/%d nodes of node pool %s are running", running, ng.Instances, nodePool.Name)
+				}
+			}
+		}
+		return true, nil
+	})
+}
+
+// scaleNodePool sets the instances of the node pool, and its autoscaling, as in the node group
+func (do *DigitalOceanCloudProvider) scaleNodePool(ctx context.Context, cluster *godo.KubernetesCluster, nodePool *godo.KubernetesNodePool, ng config.NodeGroup) error {
+	logger := util.Logger(ctx)
+
+	autoscale := ng.Autoscales()
+	req := &godo.KubernetesNodePoolUpdateRequest{
+		Count:     godo.Int(int(ng.Instances)),
+		AutoScale: godo.Bool(autoscale),
+	}
+	desc := fmt.Sprintf("%d nodes", ng.Instances)
+	if autoscale {
+		req.MinNodes = godo.Int(int(ng.MinInstances))
+		req.MaxNodes = godo.Int(int(ng.MaxInstances))
+		desc += fmt.Sprintf(", autoscaling between %d and %d nodes", ng.MinInstances, ng.MaxInstances)
+	}
+
+	if nodePool.Count == int(ng.Instances) && nodePool.AutoScale == autoscale &&
+		(!autoscale || (nodePool.MinNodes == int(ng.MinInstances) && nodePool.MaxNodes == int(ng.MaxInstances))) {
+		logger.Infof("Node pool %s already has %s", nodePool.Name, desc)
+		return nil
+	}
+	if util.IsDryRun(ctx) {
+		logger.Infof("Would scale node pool %s from %d to %s", nodePool.Name, nodePool.Count, desc)
+		return nil
+	}
+	logger.Infof("Scaling node pool %s from %d to %s", nodePool.Name, nodePool.Count, desc)
+	_, _, err := do.c.Kubernetes.UpdateNodePool(ctx, cluster.ID, nodePool.ID, req)
+	return err
+}
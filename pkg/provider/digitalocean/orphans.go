@@ -0,0 +1,171 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/digitalocean/godo"
+)
+
+const (
+	orphanDroplet      = "droplet"
+	orphanLoadBalancer = "load balancer"
+	orphanVolume       = "volume"
+
+	// DOKS tags the droplets, load balancers and volumes of a cluster with k8s:<cluster ID>
+	clusterIDTagPrefix = "k8s:"
+)
+
+func clusterIDTag(id string) string {
+	return clusterIDTagPrefix + id
+}
+
+// clusterIDFromTags returns the ID of the DOKS cluster the tags refer to, if any. Other tags with
+// the same prefix, e.g. "k8s:worker", are skipped by only accepting UUIDs.
+func clusterIDFromTags(tags []string) string {
+	for _, tag := range tags {
+		id := strings.TrimPrefix(tag, clusterIDTagPrefix)
+		if id != tag && len(id) == 36 && strings.Count(id, "-") == 4 {
+			return id
+		}
+	}
+	return ""
+}
+
+// ListOrphans returns the droplets tagged workshopctl, and the load balancers and volumes that
+// DOKS created, whose clusters don't exist anymore. Also load balancers of DOKS or workshopctl
+// that serve only droplets which don't exist anymore are returned. All clusters in the account, also those not created by
+// workshopctl, count as existing.
+func (do *DigitalOceanCloudProvider) ListOrphans(ctx context.Context) ([]provider.Orphan, error) {
+	logger := util.Logger(ctx)
+
+	clusterIDs := map[string]bool{}
+	clusterNames := map[string]bool{}
+	err := listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.Kubernetes.List(ctx, opt)
+		for _, c := range page {
+			clusterIDs[c.ID] = true
+			clusterNames[c.Name] = true
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := []provider.Orphan{}
+	dropletIDs := map[int]bool{}
+	logger.Debug("Listing droplets...")
+	err = listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.Droplets.List(ctx, opt)
+		for _, d := range page {
+			dropletIDs[d.ID] = true
+			if !hasTag(d.Tags, WorkshopctlTag) {
+				continue
+			}
+			// The droplets are tagged with both the cluster and node pool names. The node pool name
+			// starts with the cluster name, hence the shortest tag is the cluster name.
+			clusterName := ""
+			for _, tag := range d.Tags {
+				if _, ok := provider.ParseClusterName("", tag); ok && (len(clusterName) == 0 || len(tag) < len(clusterName)) {
+					clusterName = tag
+				}
+			}
+			if len(clusterName) != 0 && !clusterNames[clusterName] {
+				orphans = append(orphans, provider.Orphan{
+					Kind:   orphanDroplet,
+					ID:     strconv.Itoa(d.ID),
+					Name:   d.Name,
+					Reason: fmt.Sprintf("cluster %s doesn't exist", clusterName),
+				})
+			}
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Listing load balancers...")
+	err = listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.LoadBalancers.List(ctx, opt)
+		for _, lb := range page {
+			reason := ""
+			switch id := clusterIDFromTags(lb.Tags); {
+			case len(id) != 0 && !clusterIDs[id]:
+				reason = fmt.Sprintf("cluster with ID %s doesn't exist", id)
+			case len(lb.Tag) == 0 && len(lb.DropletIDs) != 0 && !anyExists(lb.DropletIDs, dropletIDs) &&
+				(len(id) != 0 || strings.HasPrefix(lb.Name, WorkshopctlTag+"-")):
+				// Only load balancers that DOKS or workshopctl created, not unrelated ones
+				reason = "none of the droplets it serves exist"
+			}
+			if len(reason) != 0 {
+				orphans = append(orphans, provider.Orphan{Kind: orphanLoadBalancer, ID: lb.ID, Name: lb.Name, Reason: reason})
+			}
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Listing volumes...")
+	err = listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.Storage.ListVolumes(ctx, &godo.ListVolumeParams{ListOptions: opt})
+		for _, v := range page {
+			if id := clusterIDFromTags(v.Tags); len(id) != 0 && !clusterIDs[id] {
+				orphans = append(orphans, provider.Orphan{
+					Kind:   orphanVolume,
+					ID:     v.ID,
+					Name:   v.Name,
+					Reason: fmt.Sprintf("cluster with ID %s doesn't exist", id),
+				})
+			}
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// DeleteOrphan deletes a droplet, load balancer or volume returned by ListOrphans
+func (do *DigitalOceanCloudProvider) DeleteOrphan(ctx context.Context, o provider.Orphan) error {
+	logger := util.Logger(ctx)
+
+	if util.IsDryRun(ctx) {
+		logger.Infof("Would delete %s %s (%s)", o.Kind, o.Name, o.ID)
+		return nil
+	}
+	logger.Infof("Deleting %s %s (%s)", o.Kind, o.Name, o.ID)
+	var err error
+	switch o.Kind {
+	case orphanDroplet:
+		id, convErr := strconv.Atoi(o.ID)
+		if convErr != nil {
+			return convErr
+		}
+		_, err = do.c.Droplets.Delete(ctx, id)
+	case orphanLoadBalancer:
+		_, err = do.c.LoadBalancers.Delete(ctx, o.ID)
+	case orphanVolume:
+		_, err = do.c.Storage.DeleteVolume(ctx, o.ID)
+	default:
+		err = fmt.Errorf("unknown kind of resource %q", o.Kind)
+	}
+	return err
+}
+
+func anyExists(ids []int, existing map[int]bool) bool {
+	for _, id := range ids {
+		if existing[id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/digitalocean/godo"
+)
+
+// sizeCatalog returns the droplet sizes that can be used as Kubernetes nodes, in any region. The
+// catalog is fetched once per provider, as it is the same for all clusters.
+func (do *DigitalOceanCloudProvider) sizeCatalog(ctx context.Context) ([]godo.Size, error) {
+	do.sizesMux.Lock()
+	defer do.sizesMux.Unlock()
+	if do.sizes != nil {
+		return do.sizes, nil
+	}
+
+	opts, _, err := do.c.Kubernetes.GetOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodeSizes := map[string]bool{}
+	for _, s := range opts.Sizes {
+		nodeSizes[s.Slug] = true
+	}
+
+	sizes := []godo.Size{}
+	err = listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.Sizes.List(ctx, opt)
+		for _, s := range page {
+			// Not all droplet sizes can be used for Kubernetes nodes
+			if len(nodeSizes) != 0 && !nodeSizes[s.Slug] {
+				continue
+			}
+			sizes = append(sizes, s)
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	do.sizes = sizes
+	return sizes, nil
+}
+
+// chooseSize returns the cheapest size available in the region that has at least the CPUs and
+// RAM of the claim. As the cheapest size is chosen, the kind of droplet follows from the ratio
+// between CPU and RAM, e.g. a memory-optimized droplet is chosen for 2 CPUs and 16GB RAM. If the
+// claim is dedicated, only sizes with dedicated CPUs are considered.
+func chooseSize(sizes []godo.Size, region string, c config.NodeClaim) (godo.Size, error) {
+	candidates := []godo.Size{}
+	for _, s := range sizes {
+		if !s.Available || !hasRegion(s, region) {
+			continue
+		}
+		if s.Vcpus < int(c.CPU) || s.Memory < int(c.RAM)*1024 {
+			continue
+		}
+		if c.Dedicated && !isDedicated(s.Slug) {
+			continue
+		}
+		candidates = append(candidates, s)
+	}
+	if len(candidates) == 0 {
+		return godo.Size{}, fmt.Errorf("no droplet size in region %s has at least %s", region, claimStr(c))
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].PriceMonthly != candidates[j].PriceMonthly {
+			return candidates[i].PriceMonthly < candidates[j].PriceMonthly
+		}
+		// For the same price, prefer the bigger size
+		return candidates[i].Memory > candidates[j].Memory
+	})
+	return candidates[0], nil
+}
+
+// loadBalancerPriceHourly is the price of the smallest DigitalOcean load balancer, which is what
+// the Traefik Service gets. The API doesn't tell load balancer prices. $12/month
+const loadBalancerPriceHourly = 0.01786
+
+// Prices returns the hourly prices of the sizes chosen for the node groups, in USD
+func (do *DigitalOceanCloudProvider) Prices(ctx context.Context, c provider.ClusterSpec) (*provider.Prices, error) {
+	sizes, err := do.sizeCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prices := &provider.Prices{
+		Currency:     "USD",
+		LoadBalancer: loadBalancerPriceHourly,
+	}
+	for i, ng := range c.NodeGroups {
+		size, err := chooseSize(sizes, do.region, ng.NodeClaim)
+		if err != nil {
+			return nil, fmt.Errorf("node group %d: %w", i+1, err)
+		}
+		prices.NodeGroups = append(prices.NodeGroups, size.PriceHourly)
+	}
+	return prices, nil
+}
+
+// claimForSize is the inverse of chooseSize. The zero NodeClaim is returned for unknown sizes.
+func claimForSize(sizes []godo.Size, slug string) config.NodeClaim {
+	for _, s := range sizes {
+		if s.Slug == slug {
+			return config.NodeClaim{
+				CPU:       uint16(s.Vcpus),
+				RAM:       uint16(s.Memory / 1024),
+				Dedicated: isDedicated(s.Slug),
+			}
+		}
+	}
+	return config.NodeClaim{}
+}
+
+// isDedicated tells whether the size has dedicated CPUs. All sizes except the Basic ones, whose
+// slugs start with "s-", have dedicated CPUs.
+func isDedicated(slug string) bool {
+	return !strings.HasPrefix(slug, "s-")
+}
+
+func hasRegion(s godo.Size, region string) bool {
+	for _, r := range s.Regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+func claimStr(c config.NodeClaim) string {
+	s := fmt.Sprintf("%d CPUs and %dGB RAM", c.CPU, c.RAM)
+	if c.Dedicated {
+		s += " (dedicated)"
+	}
+	return s
+}
@@ -0,0 +1,169 @@
+package digitalocean
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// The DigitalOcean API allows 250 requests per minute, leave some headroom for other clients
+	requestsPerMinute = 200
+	requestBurst      = 10
+
+	// maxAttempts is the amount of requests sent in total, i.e. including the first one
+	maxAttempts    = 6
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+
+	rateLimitResetHeader = "RateLimit-Reset"
+)
+
+// sharedTransport is used by all DigitalOcean clients, so that all clusters share the rate limit
+var sharedTransport = newRetryTransport(http.DefaultTransport)
+
+// retryTransport rate-limits the requests sent through it, and retries them with an exponential
+// backoff when the API responds with 429 Too Many Requests or a 5xx error
+type retryTransport struct {
+	next    http.RoundTripper
+	limiter *rate.Limiter
+	// initialBackoff is the wait before the first retry, it doubles with every retry
+	initialBackoff time.Duration
+
+	// pausedUntil is set when the API says the rate limit is exhausted. No requests are sent
+	// before that time.
+	mux         sync.Mutex
+	pausedUntil time.Time
+}
+
+func newRetryTransport(next http.RoundTripper) *retryTransport {
+	return &retryTransport{
+		next:           next,
+		limiter:        rate.NewLimiter(rate.Limit(requestsPerMinute/60.0), requestBurst),
+		initialBackoff: initialBackoff,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	logger := util.Logger(ctx)
+
+	backoff := t.initialBackoff
+	for attempt := 1; ; attempt++ {
+		if err := t.waitUntilResumed(req); err != nil {
+			return nil, err
+		}
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		r, err := rewind(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.next.RoundTrip(r)
+		if err != nil || !shouldRetry(req, resp) || attempt >= maxAttempts {
+			return resp, err
+		}
+
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2))
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if reset, ok := rateLimitReset(resp); ok {
+				wait = time.Until(reset)
+				t.pauseUntil(reset)
+			}
+		}
+		logger.Warnf("DigitalOcean API responded %q to %s %s, retrying in %s (attempt %d/%d)",
+			resp.Status, req.Method, req.URL.Path, wait.Round(time.Second), attempt, maxAttempts)
+		// Drain the body, so that the connection can be re-used
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// shouldRetry tells whether the request should be retried. Requests that failed with a 5xx error
+// might have been carried out anyway, hence only idempotent requests are retried in that case.
+func shouldRetry(req *http.Request, resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if resp.StatusCode < 500 {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// rewind returns the request to send for the given attempt. The body is consumed by every
+// attempt, hence it needs to be re-created for the retries.
+func rewind(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 1 || req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// rateLimitReset returns the time the rate limit is reset, as told by the RateLimit-Reset header
+func rateLimitReset(resp *http.Response) (time.Time, bool) {
+	secs, err := strconv.ParseInt(resp.Header.Get(rateLimitResetHeader), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	reset := time.Unix(secs, 0)
+	// Guard against clock skew, and the reset being far away
+	if !reset.After(time.Now()) || time.Until(reset) > 2*maxBackoff {
+		return time.Time{}, false
+	}
+	return reset, true
+}
+
+func (t *retryTransport) pauseUntil(until time.Time) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if until.After(t.pausedUntil) {
+		t.pausedUntil = until
+	}
+}
+
+func (t *retryTransport) waitUntilResumed(req *http.Request) error {
+	t.mux.Lock()
+	wait := time.Until(t.pausedUntil)
+	t.mux.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	util.Logger(req.Context()).Infof("DigitalOcean API rate limit exhausted, waiting %s before sending %s %s",
+		wait.Round(time.Second), req.Method, req.URL.Path)
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
@@ -0,0 +1,168 @@
+package digitalocean
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI responds with the queued status codes per path, and 200 OK once they run out. It
+// records the received requests.
+type fakeAPI struct {
+	mu       sync.Mutex
+	statuses map[string][]int
+	header   http.Header
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	method string
+	path   string
+	body   string
+	at     time.Time
+}
+
+func newFakeAPI(t *testing.T, statuses map[string][]int) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{statuses: statuses, header: http.Header{}}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.requests = append(api.requests, receivedRequest{r.Method, r.URL.Path, string(body), time.Now()})
+
+	status := http.StatusOK
+	if queued := api.statuses[r.URL.Path]; len(queued) != 0 {
+		status, api.statuses[r.URL.Path] = queued[0], queued[1:]
+		for k, v := range api.header {
+			w.Header()[k] = v
+		}
+	}
+	w.WriteHeader(status)
+}
+
+// received returns the requests received for the given path
+func (api *fakeAPI) received(path string) []receivedRequest {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	reqs := []receivedRequest{}
+	for _, r := range api.requests {
+		if r.path == path {
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+func send(t *testing.T, tr http.RoundTripper, method, url, body string) *http.Response {
+	req, err := http.NewRequestWithContext(context.Background(), method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestRateLimitResetPausesAllRequests(t *testing.T) {
+	api, srv := newFakeAPI(t, map[string][]int{"/v2/droplets": {http.StatusTooManyRequests}})
+	reset := time.Now().Add(2 * time.Second).Truncate(time.Second)
+	api.header.Set(rateLimitResetHeader, strconv.FormatInt(reset.Unix(), 10))
+	tr := newRetryTransport(http.DefaultTransport)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		send(t, tr, http.MethodGet, srv.URL+"/v2/droplets", "")
+	}()
+	// Send another request once the first one has hit the rate limit
+	for len(api.received("/v2/droplets")) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if resp := send(t, tr, http.MethodGet, srv.URL+"/v2/volumes", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK, got %s", resp.Status)
+	}
+	wg.Wait()
+
+	if reqs := api.received("/v2/droplets"); len(reqs) != 2 || reqs[1].at.Before(reset) {
+		t.Errorf("expected the request to be retried after %s, got %v", reset, reqs)
+	}
+	if reqs := api.received("/v2/volumes"); len(reqs) != 1 || reqs[0].at.Before(reset) {
+		t.Errorf("expected the other request to wait until %s, got %v", reset, reqs)
+	}
+}
+
+func TestServerErrorsRetryIdempotentRequests(t *testing.T) {
+	api, srv := newFakeAPI(t, map[string][]int{
+		"/v2/droplets/1": {http.StatusServiceUnavailable},
+		"/v2/droplets":   {http.StatusServiceUnavailable},
+	})
+	tr := newRetryTransport(http.DefaultTransport)
+
+	if resp := send(t, tr, http.MethodDelete, srv.URL+"/v2/droplets/1", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the DELETE to be retried until 200 OK, got %s", resp.Status)
+	}
+	if n := len(api.received("/v2/droplets/1")); n != 2 {
+		t.Errorf("expected the DELETE to be sent twice, got %d", n)
+	}
+
+	// A POST might have been carried out anyway, hence it isn't retried
+	if resp := send(t, tr, http.MethodPost, srv.URL+"/v2/droplets", `{"name":"test"}`); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the POST to fail with 503 Service Unavailable, got %s", resp.Status)
+	}
+	if n := len(api.received("/v2/droplets")); n != 1 {
+		t.Errorf("expected the POST to be sent once, got %d", n)
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	api, srv := newFakeAPI(t, map[string][]int{"/v2/droplets": {http.StatusTooManyRequests}})
+	tr := newRetryTransport(http.DefaultTransport)
+
+	body := `{"name":"test"}`
+	if resp := send(t, tr, http.MethodPost, srv.URL+"/v2/droplets", body); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the POST to be retried until 200 OK, got %s", resp.Status)
+	}
+	reqs := api.received("/v2/droplets")
+	if len(reqs) != 2 {
+		t.Fatalf("expected the POST to be sent twice, got %d", len(reqs))
+	}
+	for i, r := range reqs {
+		if r.body != body {
+			t.Errorf("attempt %d: expected body %q, got %q", i+1, body, r.body)
+		}
+	}
+}
+
+func TestRetriesStopAfterMaxAttempts(t *testing.T) {
+	statuses := make([]int, maxAttempts+1)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	api, srv := newFakeAPI(t, map[string][]int{"/v2/droplets": statuses})
+	tr := newRetryTransport(http.DefaultTransport)
+	tr.initialBackoff = time.Millisecond
+
+	if resp := send(t, tr, http.MethodGet, srv.URL+"/v2/droplets", ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the last 503 Service Unavailable to be returned, got %s", resp.Status)
+	}
+	if n := len(api.received("/v2/droplets")); n != maxAttempts {
+		t.Errorf("expected the GET to be sent %d times, got %d", maxAttempts, n)
+	}
+}
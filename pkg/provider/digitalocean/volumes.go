@@ -0,0 +1,130 @@
+package digitalocean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/digitalocean/godo"
+)
+
+// csiDriver is the name of the DigitalOcean block storage CSI driver
+const csiDriver = "dobs.csi.digitalocean.com"
+
+// listVolumesForCluster returns the block storage volumes of the PersistentVolumes of the cluster.
+// DOKS tags the volumes with the cluster ID. Volumes that lack the tag are found through the
+// volume handles of the PersistentVolumes in the cluster.
+func (do *DigitalOceanCloudProvider) listVolumesForCluster(ctx context.Context, cluster *godo.KubernetesCluster) ([]godo.Volume, error) {
+	logger := util.Logger(ctx)
+
+	volumeIDs, err := do.listPVVolumeIDs(ctx, cluster)
+	if err != nil {
+		// The cluster might be broken, which is a common reason to delete it. Go with the tags only.
+		logger.Warnf("Couldn't list the PersistentVolumes of cluster %s, hence only deleting the volumes tagged with its ID: %v", cluster.Name, err)
+	}
+
+	volumes := []godo.Volume{}
+	err = listAll(func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := do.c.Storage.ListVolumes(ctx, &godo.ListVolumeParams{ListOptions: opt})
+		for _, v := range page {
+			if hasTag(v.Tags, clusterIDTag(cluster.ID)) {
+				logger.Debugf("Volume %s is tagged with the ID of the cluster", v.Name)
+			} else if volumeIDs[v.ID] {
+				logger.Debugf("Volume %s backs a PersistentVolume of the cluster", v.Name)
+			} else {
+				continue
+			}
+			volumes = append(volumes, v)
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return volumes, nil
+}
+
+// listPVVolumeIDs returns the IDs of the volumes backing the PersistentVolumes of the cluster
+func (do *DigitalOceanCloudProvider) listPVVolumeIDs(ctx context.Context, cluster *godo.KubernetesCluster) (map[string]bool, error) {
+	cc, _, err := do.c.Kubernetes.GetKubeConfig(ctx, cluster.ID)
+	if err != nil {
+		return nil, err
+	}
+	// The kubeconfig of the cluster might not exist locally, e.g. when reaping, hence use a
+	// temporary file
+	f, err := ioutil.TempFile("", "workshopctl-do-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(cc.KubeconfigYAML)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Only stdout is parsed, as kubectl might print warnings to stderr
+	var stdout bytes.Buffer
+	if _, _, err := util.ReadOnlyCommand(ctx, "kubectl",
+		"--kubeconfig", f.Name(),
+		"get", "persistentvolumes", "-o", "json",
+	).WithStdio(nil, &stdout, nil).Run(); err != nil {
+		return nil, err
+	}
+
+	pvs := struct {
+		Items []struct {
+			Spec struct {
+				CSI *struct {
+					Driver       string `json:"driver"`
+					VolumeHandle string `json:"volumeHandle"`
+				} `json:"csi"`
+			} `json:"spec"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &pvs); err != nil {
+		return nil, fmt.Errorf("couldn't parse the PersistentVolumes: %w", err)
+	}
+	ids := map[string]bool{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csiDriver {
+			ids[pv.Spec.CSI.VolumeHandle] = true
+		}
+	}
+	return ids, nil
+}
+
+// deleteVolumes deletes the volumes of a cluster that is being deleted. The volumes can only be
+// deleted once they have been detached from the nodes, which happens as the nodes are deleted,
+// hence the deletion is retried until it succeeds.
+func (do *DigitalOceanCloudProvider) deleteVolumes(ctx context.Context, volumes []godo.Volume) error {
+	logger := util.Logger(ctx)
+
+	for _, v := range volumes {
+		if util.IsDryRun(ctx) {
+			logger.Infof("Would delete volume %s (%s, %dGB)", v.Name, v.ID, v.SizeGigaBytes)
+			continue
+		}
+		logger.Infof("Deleting volume %s (%s, %dGB)", v.Name, v.ID, v.SizeGigaBytes)
+		v := v
+		err := util.Poll(ctx, nil, func() (bool, error) {
+			resp, err := do.c.Storage.DeleteVolume(ctx, v.ID)
+			if err == nil || (resp != nil && resp.StatusCode == http.StatusNotFound) {
+				// Also deleted if the volume is gone already
+				return true, nil
+			}
+			return false, fmt.Errorf("volume %s couldn't be deleted yet: %w", v.Name, err)
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't delete volume %s: %w", v.Name, err)
+		}
+	}
+	return nil
+}
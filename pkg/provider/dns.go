@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config/keyval"
+	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+	"github.com/cloud-native-nordics/workshopctl/pkg/gen"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// externalDNSTXTPrefixes are the record type prefixes external-dns adds to the first label
+// of its TXT registry records, e.g. "a-cluster-01.example.com".
+var externalDNSTXTPrefixes = []string{"a-", "aaaa-", "cname-"}
+
+// RecordBelongsTo tells whether the fully-qualified record name is clusterDomain or a sub-domain
+// of it. Only whole labels are matched, hence "cluster-11.example.com" doesn't belong to
+// "cluster-1.example.com". The TXT registry records of external-dns are taken into account.
+func RecordBelongsTo(fqdn, clusterDomain string) bool {
+	fqdn = normalizeName(fqdn)
+	clusterDomain = normalizeName(clusterDomain)
+	if fqdn == clusterDomain || strings.HasSuffix(fqdn, "."+clusterDomain) {
+		return true
+	}
+	for _, prefix := range externalDNSTXTPrefixes {
+		if fqdn == prefix+clusterDomain {
+			return true
+		}
+	}
+	return false
+}
+
+// ExternalDNSOwnerID is the --txt-owner-id external-dns runs with in every cluster
+const ExternalDNSOwnerID = "workshopctl"
+
+// DNSRecord is a provider-agnostic view of a DNS record. Name is fully-qualified.
+type DNSRecord struct {
+	Name string
+	Type string
+	Data string
+	// ProviderData may be used by the provider to map the record back to its own type
+	ProviderData interface{}
+}
+
+func (r DNSRecord) String() string {
+	return fmt.Sprintf("%s %s: %s", r.Type, r.Name, r.Data)
+}
+
+// IsOwnershipRecord tells whether the record is a TXT registry record of the external-dns
+// instance deployed by workshopctl, i.e. it has heritage=external-dns and the right owner.
+func IsOwnershipRecord(r DNSRecord) bool {
+	if r.Type != "TXT" {
+		return false
+	}
+	heritage, owner := false, false
+	for _, label := range strings.Split(strings.Trim(r.Data, `"`), ",") {
+		switch label {
+		case "heritage=external-dns":
+			heritage = true
+		case "external-dns/owner=" + ExternalDNSOwnerID:
+			owner = true
+		}
+	}
+	return heritage && owner
+}
+
+// OwnedRecords returns the records under clusterDomain that external-dns has created, together
+// with their TXT registry records. A/AAAA/CNAME records are only included if there is a TXT
+// ownership record for them, hence records created by hand are left alone. Records of other
+// clusters are never included, as names are matched on whole labels.
+func OwnedRecords(records []DNSRecord, clusterDomain string) []DNSRecord {
+	// Collect the names external-dns claims ownership of. Depending on the external-dns version,
+	// the TXT record has the same name as the record it owns, or a record type prefix.
+	owned := map[string]bool{}
+	ownership := []DNSRecord{}
+	for _, r := range records {
+		if !IsOwnershipRecord(r) || !RecordBelongsTo(r.Name, clusterDomain) {
+			continue
+		}
+		ownership = append(ownership, r)
+		name := normalizeName(r.Name)
+		owned[name] = true
+		for _, prefix := range externalDNSTXTPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				owned[strings.TrimPrefix(name, prefix)] = true
+			}
+		}
+	}
+
+	result := []DNSRecord{}
+	for _, r := range records {
+		switch r.Type {
+		case "A", "AAAA", "CNAME":
+			if owned[normalizeName(r.Name)] && RecordBelongsTo(r.Name, clusterDomain) {
+				result = append(result, r)
+			}
+		}
+	}
+	return append(result, ownership...)
+}
+
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// DNSEnvProcessor appends environment variables to the traefik and external-dns containers,
+// which is how the DNS providers hand them their credentials from the workshopctl Secret.
+type DNSEnvProcessor struct {
+	// TraefikEnv is a sequence of EnvVars for the traefik container
+	TraefikEnv *kyaml.RNode
+	// ExternalDNSEnv is a sequence of EnvVars for the external-dns container
+	ExternalDNSEnv *kyaml.RNode
+}
+
+var _ gen.Processor = &DNSEnvProcessor{}
+
+func (pr *DNSEnvProcessor) Process(ctx context.Context, cd *gen.ChartData, p *keyval.Parameters, r io.Reader, w io.Writer) error {
+	return util.KYAMLFilter(r, w, util.KYAMLFilterFunc(
+		func(node *kyaml.RNode) (*kyaml.RNode, error) {
+			return node, util.KYAMLResourceMetaMatcher(node, util.KYAMLResourceMetaMatch{
+				Kind:      "Deployment",
+				Name:      "traefik",
+				Namespace: constants.WorkshopctlNamespace,
+				Func: func() error {
+					return appendEnv(node, "traefik", pr.TraefikEnv)
+				},
+			}, util.KYAMLResourceMetaMatch{
+				Kind:      "Deployment",
+				Name:      "external-dns",
+				Namespace: constants.WorkshopctlNamespace,
+				Func: func() error {
+					return appendEnv(node, "external-dns", pr.ExternalDNSEnv)
+				},
+			})
+		},
+	))
+}
+
+func appendEnv(node *kyaml.RNode, container string, env *kyaml.RNode) error {
+	if env == nil {
+		return nil
+	}
+	return node.PipeE(
+		kyaml.LookupCreate(kyaml.SequenceNode, "spec", "template", "spec", "containers", "[name="+container+"]", "env"),
+		kyaml.Append(env.YNode().Content...))
+}
@@ -0,0 +1,498 @@
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/hetznercloud/hcloud-go/hcloud"
+)
+
+var clusterNotFound = fmt.Errorf("couldn't find cluster by name")
+
+const (
+	// Helsinki is the closest location for most Nordic workshops
+	DefaultLocation = "hel1"
+	DefaultImage    = "ubuntu-22.04"
+	// The smallest load balancer type is enough for the API server
+	DefaultLoadBalancerType = "lb11"
+
+	LocationKey = "location"
+	ImageKey    = "image"
+	// EndpointKey allows pointing the provider at another API endpoint, e.g. a local stand-in for testing
+	EndpointKey = "endpoint"
+
+	// WorkshopctlLabel is set on all resources created by workshopctl, with the cluster name as the value
+	WorkshopctlLabel = "workshopctl"
+	// RoleLabel is set on all servers, with either roleServer or roleAgent as the value
+	RoleLabel  = "workshopctl-role"
+	roleServer = "server"
+	roleAgent  = "agent"
+)
+
+func NewHetznerCloudProvider(ctx context.Context, p *config.Provider) (provider.CloudProvider, error) {
+	opts := []hcloud.ClientOption{
+		hcloud.WithToken(p.ServiceAccountContent),
+		hcloud.WithApplication("workshopctl", ""),
+	}
+	if endpoint, ok := p.ProviderSpecific[EndpointKey]; ok {
+		opts = append(opts, hcloud.WithEndpoint(endpoint))
+	}
+
+	hzProvider := &HetznerCloudProvider{
+		c:        hcloud.NewClient(opts...),
+		dryRun:   util.IsDryRun(ctx),
+		location: DefaultLocation,
+		image:    DefaultImage,
+	}
+	if l, ok := p.ProviderSpecific[LocationKey]; ok {
+		hzProvider.location = l
+	}
+	if i, ok := p.ProviderSpecific[ImageKey]; ok {
+		hzProvider.image = i
+	}
+	return hzProvider, nil
+}
+
+// HetznerCloudProvider runs k3s on plain Hetzner Cloud servers, as Hetzner doesn't offer managed
+// Kubernetes. The first server runs the k3s server, and the rest join it as agents. The API server
+// is exposed through a Hetzner load balancer.
+type HetznerCloudProvider struct {
+	c      *hcloud.Client
+	dryRun bool
+
+	location string
+	image    string
+
+	// serverTypes caches the server type catalog, see serverTypeCatalog
+	serverTypes    []*hcloud.ServerType
+	serverTypesMux sync.Mutex
+}
+
+// Prices returns the hourly prices, including VAT, of the server types chosen for the node groups
+// and of the API server load balancer in the configured location
+func (hz *HetznerCloudProvider) Prices(ctx context.Context, c provider.ClusterSpec) (*provider.Prices, error) {
+	serverTypes, err := hz.chooseServerTypes(ctx, c.NodeGroups)
+	if err != nil {
+		return nil, err
+	}
+	prices := &provider.Prices{}
+	for _, st := range serverTypes {
+		// chooseServerType only returns server types available in the location
+		p, _ := locationPricing(st, hz.location)
+		price, err := parsePrice(p.Hourly, prices)
+		if err != nil {
+			return nil, err
+		}
+		prices.NodeGroups = append(prices.NodeGroups, price)
+	}
+
+	lbt, _, err := hz.c.LoadBalancerType.GetByName(ctx, DefaultLoadBalancerType)
+	if err != nil {
+		return nil, err
+	}
+	if lbt == nil {
+		return nil, fmt.Errorf("load balancer type %s doesn't exist", DefaultLoadBalancerType)
+	}
+	for _, p := range lbt.Pricings {
+		if p.Location.Name != hz.location {
+			continue
+		}
+		if prices.LoadBalancer, err = parsePrice(p.Hourly, prices); err != nil {
+			return nil, err
+		}
+	}
+	return prices, nil
+}
+
+// parsePrice parses the gross price, and records its currency in prices
+func parsePrice(p hcloud.Price, prices *provider.Prices) (float64, error) {
+	prices.Currency = p.Currency
+	return strconv.ParseFloat(p.Gross, 64)
+}
+
+func (hz *HetznerCloudProvider) CreateCluster(ctx context.Context, m provider.ClusterMeta, c provider.ClusterSpec) (*provider.Cluster, error) {
+	logger := util.Logger(ctx)
+
+	start := time.Now().UTC()
+	cluster := &provider.Cluster{
+		ClusterMeta: m,
+		Spec:        c,
+		Status: provider.ClusterStatus{
+			ProvisionStart: &start,
+		},
+	}
+
+	// As the kubeconfig is derived from CAs that only exist in memory during creation, an
+	// already existing cluster can't be adopted
+	if _, err := hz.getServerNode(ctx, cluster.Name()); err == nil {
+		return nil, fmt.Errorf("cluster %s already exists, but its kubeconfig can't be recovered. Please delete it first", cluster.Name())
+	} else if !errors.Is(err, clusterNotFound) {
+		return nil, err
+	}
+
+	for i, ng := range c.NodeGroups {
+		if ng.Autoscales() {
+			logger.Warnf("Hetzner can't autoscale node groups, hence node group %d gets a fixed %d nodes", i+1, ng.Instances)
+		}
+	}
+
+	serverTypes, err := hz.chooseServerTypes(ctx, c.NodeGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	pki, err := newK3sPKI()
+	if err != nil {
+		return nil, err
+	}
+
+	lbReq := hcloud.LoadBalancerCreateOpts{
+		Name:             cluster.Name(),
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: DefaultLoadBalancerType},
+		Location:         &hcloud.Location{Name: hz.location},
+		Labels:           hz.labels(cluster.Name(), "", c),
+		Targets: []hcloud.LoadBalancerCreateOptsTarget{
+			{
+				Type: hcloud.LoadBalancerTargetTypeLabelSelector,
+				LabelSelector: hcloud.LoadBalancerCreateOptsTargetLabelSelector{
+					Selector: fmt.Sprintf("%s=%s,%s=%s", WorkshopctlLabel, cluster.Name(), RoleLabel, roleServer),
+				},
+			},
+		},
+		Services: []hcloud.LoadBalancerCreateOptsService{
+			{
+				Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+				ListenPort:      hcloud.Int(apiServerPort),
+				DestinationPort: hcloud.Int(apiServerPort),
+			},
+		},
+		PublicInterface: hcloud.Bool(true),
+	}
+
+	if hz.dryRun {
+		b, _ := json.Marshal(lbReq)
+		logger.Infof("Would send this load balancer request to Hetzner: %s", string(b))
+		return cluster, nil
+	}
+	util.DebugObject(ctx, "Load balancer request", lbReq)
+
+	lb, err := hz.ensureLB(ctx, lbReq)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := lb.PublicNet.IPv4.IP
+	cluster.Status.EndpointIP = endpoint
+	cluster.Status.EndpointURL, _ = url.Parse(apiServerURL(endpoint))
+	logger.Infof("Load balancer %s got IP %s", lb.Name, endpoint)
+
+	isServer := true
+	for i, ng := range c.NodeGroups {
+		// This starts from 01, and always is padded to two digits like the cluster number
+		idx := config.ClusterNumber(i + 1)
+		for j := 1; j <= int(ng.Instances); j++ {
+			role := roleAgent
+			if isServer {
+				role = roleServer
+			}
+			userData, err := pki.cloudInit(isServer, c.Version, endpoint, ng)
+			if err != nil {
+				return nil, err
+			}
+
+			serverName := fmt.Sprintf("%s-nodepool-%s-%d", cluster.Name(), idx, j)
+			logger.Infof("Creating %s %s", role, serverName)
+			res, _, err := hz.c.Server.Create(ctx, hcloud.ServerCreateOpts{
+				Name:       serverName,
+				ServerType: &hcloud.ServerType{Name: serverTypes[i].Name},
+				Image:      &hcloud.Image{Name: hz.image},
+				Location:   &hcloud.Location{Name: hz.location},
+				UserData:   userData,
+				Labels:     hz.labels(cluster.Name(), role, c),
+			})
+			if err != nil {
+				return nil, err
+			}
+			if isServer {
+				cluster.Status.ID = strconv.Itoa(res.Server.ID)
+			}
+			isServer = false
+		}
+	}
+	if len(cluster.Status.ID) == 0 {
+		return nil, fmt.Errorf("at least one node is needed for cluster %s", cluster.Name())
+	}
+
+	kubeconfig, err := pki.kubeconfig(cluster.Name(), endpoint)
+	if err != nil {
+		return nil, err
+	}
+	cluster.Status.KubeconfigBytes = kubeconfig
+
+	httpClient, err := pki.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	readyzURL := apiServerURL(endpoint) + "/readyz"
+	err = util.Poll(ctx, nil, func() (bool, error) {
+		resp, err := httpClient.Get(readyzURL)
+		if err != nil {
+			return false, fmt.Errorf("k3s is still being installed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return false, fmt.Errorf("k3s API server isn't ready yet, got status %d", resp.StatusCode)
+		}
+		logger.Infof("Awesome, the cluster is Ready! Endpoint: %s", apiServerURL(endpoint))
+		now := time.Now().UTC()
+		cluster.Status.ProvisionDone = &now
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+func (hz *HetznerCloudProvider) DeleteCluster(ctx context.Context, m provider.ClusterMeta) error {
+	selector := fmt.Sprintf("%s=%s", WorkshopctlLabel, m.Name())
+
+	lbs, err := hz.c.LoadBalancer.AllWithOpts(ctx, hcloud.LoadBalancerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: selector},
+	})
+	if err != nil {
+		return err
+	}
+	util.DebugObject(ctx, "LBs", lbs)
+	for _, lb := range lbs {
+		if err := hz.deleteLB(ctx, lb); err != nil {
+			return err
+		}
+	}
+
+	servers, err := hz.c.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: selector},
+	})
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("%w: %s", clusterNotFound, m.Name())
+	}
+	for _, server := range servers {
+		if err := hz.deleteServer(ctx, server); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetKubeconfig always returns ErrKubeconfigUnrecoverable, as the kubeconfig is derived from CAs
+// that only exist in memory during creation
+func (hz *HetznerCloudProvider) GetKubeconfig(ctx context.Context, m provider.ClusterMeta) ([]byte, error) {
+	return nil, fmt.Errorf("cluster %s: %w, as it is signed by CAs that only existed during creation", m.Name(), provider.ErrKubeconfigUnrecoverable)
+}
+
+func (hz *HetznerCloudProvider) ListClusters(ctx context.Context, namePrefix string) ([]*provider.Cluster, error) {
+	// Only list servers that have the workshopctl label, regardless of its value
+	servers, err := hz.c.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: WorkshopctlLabel},
+	})
+	if err != nil {
+		return nil, err
+	}
+	lbs, err := hz.c.LoadBalancer.AllWithOpts(ctx, hcloud.LoadBalancerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: WorkshopctlLabel},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := map[string]*provider.Cluster{}
+	result := []*provider.Cluster{}
+	for _, server := range servers {
+		m, ok := provider.ParseClusterName(namePrefix, server.Labels[WorkshopctlLabel])
+		if !ok {
+			continue
+		}
+		cluster, ok := clusters[m.Name()]
+		if !ok {
+			cluster = &provider.Cluster{
+				ClusterMeta: m,
+				Spec: provider.ClusterSpec{
+					NodeGroups: []config.NodeGroup{},
+				},
+			}
+			clusters[m.Name()] = cluster
+			result = append(result, cluster)
+		}
+		if server.Labels[RoleLabel] == roleServer {
+			cluster.Status.ID = strconv.Itoa(server.ID)
+			cluster.Spec.ExpiresAt, _ = provider.ParseExpiry(server.Labels[provider.ExpiresAtKey])
+			cluster.Spec.RootDomain = server.Labels[provider.RootDomainKey]
+		}
+
+		// Servers are named <cluster>-nodepool-<node group>-<instance>
+		var ng int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(server.Name, m.Name()), "-nodepool-%d-", &ng); err != nil || ng < 1 {
+			continue
+		}
+		for len(cluster.Spec.NodeGroups) < ng {
+			cluster.Spec.NodeGroups = append(cluster.Spec.NodeGroups, config.NodeGroup{})
+		}
+		cluster.Spec.NodeGroups[ng-1].Instances++
+		if server.ServerType != nil {
+			cluster.Spec.NodeGroups[ng-1].NodeClaim = claimForServerType(server.ServerType)
+		}
+	}
+
+	for _, lb := range lbs {
+		if cluster, ok := clusters[lb.Labels[WorkshopctlLabel]]; ok {
+			cluster.Status.EndpointIP = lb.PublicNet.IPv4.IP
+			cluster.Status.EndpointURL, _ = url.Parse(apiServerURL(lb.PublicNet.IPv4.IP))
+		}
+	}
+	return result, nil
+}
+
+// ListOrphans returns the load balancers labelled with the name of a cluster that has no servers,
+// e.g. because creating the cluster failed half-way
+func (hz *HetznerCloudProvider) ListOrphans(ctx context.Context) ([]provider.Orphan, error) {
+	servers, err := hz.c.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: WorkshopctlLabel},
+	})
+	if err != nil {
+		return nil, err
+	}
+	lbs, err := hz.c.LoadBalancer.AllWithOpts(ctx, hcloud.LoadBalancerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: WorkshopctlLabel},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := map[string]bool{}
+	for _, server := range servers {
+		clusters[server.Labels[WorkshopctlLabel]] = true
+	}
+	orphans := []provider.Orphan{}
+	for _, lb := range lbs {
+		if clusterName := lb.Labels[WorkshopctlLabel]; !clusters[clusterName] {
+			orphans = append(orphans, provider.Orphan{
+				Kind:   "load balancer",
+				ID:     strconv.Itoa(lb.ID),
+				Name:   lb.Name,
+				Reason: fmt.Sprintf("cluster %s has no servers", clusterName),
+			})
+		}
+	}
+	return orphans, nil
+}
+
+// DeleteOrphan deletes a load balancer returned by ListOrphans
+func (hz *HetznerCloudProvider) DeleteOrphan(ctx context.Context, o provider.Orphan) error {
+	id, err := strconv.Atoi(o.ID)
+	if err != nil {
+		return err
+	}
+	return hz.deleteLB(ctx, &hcloud.LoadBalancer{ID: id, Name: o.Name})
+}
+
+func (hz *HetznerCloudProvider) labels(clusterName, role string, c provider.ClusterSpec) map[string]string {
+	labels := map[string]string{
+		WorkshopctlLabel: clusterName,
+	}
+	if len(role) != 0 {
+		labels[RoleLabel] = role
+	}
+	if c.ExpiresAt != nil {
+		labels[provider.ExpiresAtKey] = provider.FormatExpiry(*c.ExpiresAt)
+	}
+	if len(c.RootDomain) != 0 {
+		labels[provider.RootDomainKey] = c.RootDomain
+	}
+	return labels
+}
+
+func (hz *HetznerCloudProvider) getServerNode(ctx context.Context, clusterName string) (*hcloud.Server, error) {
+	logger := util.Logger(ctx)
+
+	logger.Debug("Listing servers...")
+	servers, err := hz.c.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{
+			LabelSelector: fmt.Sprintf("%s=%s,%s=%s", WorkshopctlLabel, clusterName, RoleLabel, roleServer),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("%w: %s", clusterNotFound, clusterName)
+	}
+	return servers[0], nil
+}
+
+// ensureLB creates the load balancer, or re-uses it if a previous attempt already created it
+func (hz *HetznerCloudProvider) ensureLB(ctx context.Context, req hcloud.LoadBalancerCreateOpts) (*hcloud.LoadBalancer, error) {
+	logger := util.Logger(ctx)
+
+	lb, _, err := hz.c.LoadBalancer.GetByName(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if lb != nil {
+		logger.Infof("Found existing load balancer with name %q and ID %d", lb.Name, lb.ID)
+		return lb, nil
+	}
+
+	logger.Infof("Creating load balancer %s", req.Name)
+	res, _, err := hz.c.LoadBalancer.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := hz.waitForAction(ctx, res.Action); err != nil {
+		return nil, err
+	}
+	// Get the load balancer again, now that it has a public IP
+	lb, _, err = hz.c.LoadBalancer.GetByID(ctx, res.LoadBalancer.ID)
+	return lb, err
+}
+
+func (hz *HetznerCloudProvider) waitForAction(ctx context.Context, action *hcloud.Action) error {
+	_, errCh := hz.c.Action.WatchProgress(ctx, action)
+	return <-errCh
+}
+
+func (hz *HetznerCloudProvider) deleteServer(ctx context.Context, server *hcloud.Server) error {
+	logger := util.Logger(ctx)
+
+	if hz.dryRun {
+		logger.Infof("Would delete server %s", server.Name)
+		return nil
+	}
+	logger.Infof("Deleting server %s", server.Name)
+	_, err := hz.c.Server.Delete(ctx, server)
+	return err
+}
+
+func (hz *HetznerCloudProvider) deleteLB(ctx context.Context, lb *hcloud.LoadBalancer) error {
+	logger := util.Logger(ctx)
+
+	if hz.dryRun {
+		logger.Infof("Would delete load balancer %s", lb.Name)
+		return nil
+	}
+	logger.Infof("Deleting load balancer %s", lb.Name)
+	_, err := hz.c.LoadBalancer.Delete(ctx, lb)
+	return err
+}
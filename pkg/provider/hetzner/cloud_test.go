@@ -0,0 +1,361 @@
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/hetznercloud/hcloud-go/hcloud/schema"
+)
+
+// fakeAPI is a minimal in-memory stand-in for the Hetzner Cloud API, covering the endpoints used
+// for creating and deleting clusters
+type fakeAPI struct {
+	mu      sync.Mutex
+	nextID  int
+	servers map[int]schema.Server
+	lbs     map[int]schema.LoadBalancer
+	// deleted records the deleted resources as "<kind>/<name>", in order
+	deleted []string
+}
+
+// testServerTypes is a part of the Hetzner server type catalog, with the hourly gross prices in
+// the default location
+var testServerTypes = []schema.ServerType{
+	serverType("cx22", 2, 4, "shared", "0.0060"),
+	serverType("cpx21", 3, 4, "shared", "0.0097"),
+	serverType("cx32", 4, 8, "shared", "0.0113"),
+	serverType("ccx13", 2, 8, "dedicated", "0.0238"),
+	serverType("ccx23", 4, 16, "dedicated", "0.0476"),
+}
+
+func serverType(name string, cores int, memory float32, cpuType, hourly string) schema.ServerType {
+	st := schema.ServerType{Name: name, Cores: cores, Memory: memory, CPUType: cpuType}
+	st.Prices = []schema.PricingServerTypePrice{{Location: DefaultLocation}}
+	st.Prices[0].PriceHourly.Gross = hourly
+	return st
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{
+		nextID:  1,
+		servers: map[int]schema.Server{},
+		lbs:     map[int]schema.LoadBalancer{},
+	}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var id int
+	if len(parts) == 2 {
+		var err error
+		if id, err = strconv.Atoi(parts[1]); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && parts[0] == "actions" && len(parts) == 2:
+		writeJSON(w, schema.ActionGetResponse{Action: schema.Action{ID: id, Status: "success"}})
+
+	case r.Method == http.MethodGet && parts[0] == "server_types":
+		writeJSON(w, schema.ServerTypeListResponse{ServerTypes: testServerTypes})
+
+	case r.Method == http.MethodGet && parts[0] == "servers" && len(parts) == 1:
+		resp := schema.ServerListResponse{Servers: []schema.Server{}}
+		for _, s := range api.servers {
+			if matchesSelector(s.Labels, r.URL.Query().Get("label_selector")) {
+				resp.Servers = append(resp.Servers, s)
+			}
+		}
+		writeJSON(w, resp)
+	case r.Method == http.MethodPost && parts[0] == "servers":
+		req := schema.ServerCreateRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s := schema.Server{ID: api.id(), Name: req.Name, Labels: *req.Labels}
+		for _, st := range testServerTypes {
+			if st.Name == req.ServerType.(string) {
+				s.ServerType = st
+			}
+		}
+		api.servers[s.ID] = s
+		writeJSON(w, schema.ServerCreateResponse{Server: s, Action: schema.Action{ID: api.id(), Status: "success"}})
+	case r.Method == http.MethodDelete && parts[0] == "servers":
+		api.deleted = append(api.deleted, "server/"+api.servers[id].Name)
+		delete(api.servers, id)
+
+	case r.Method == http.MethodGet && parts[0] == "load_balancers" && len(parts) == 1:
+		resp := schema.LoadBalancerListResponse{LoadBalancers: []schema.LoadBalancer{}}
+		name := r.URL.Query().Get("name")
+		for _, lb := range api.lbs {
+			if (len(name) == 0 || lb.Name == name) && matchesSelector(lb.Labels, r.URL.Query().Get("label_selector")) {
+				resp.LoadBalancers = append(resp.LoadBalancers, lb)
+			}
+		}
+		writeJSON(w, resp)
+	case r.Method == http.MethodGet && parts[0] == "load_balancers":
+		writeJSON(w, schema.LoadBalancerGetResponse{LoadBalancer: api.lbs[id]})
+	case r.Method == http.MethodPost && parts[0] == "load_balancers":
+		req := schema.LoadBalancerCreateRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lb := schema.LoadBalancer{ID: api.id(), Name: req.Name, Labels: *req.Labels}
+		lb.PublicNet.IPv4.IP = "127.0.0.1"
+		api.lbs[lb.ID] = lb
+		writeJSON(w, schema.LoadBalancerCreateResponse{LoadBalancer: lb, Action: schema.Action{ID: api.id(), Status: "running"}})
+	case r.Method == http.MethodDelete && parts[0] == "load_balancers":
+		api.deleted = append(api.deleted, "load balancer/"+api.lbs[id].Name)
+		delete(api.lbs, id)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (api *fakeAPI) id() int {
+	api.nextID++
+	return api.nextID
+}
+
+// addServer adds a server of the cluster with the given role
+func (api *fakeAPI) addServer(clusterName, name, role string) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	s := schema.Server{ID: api.id(), Name: name, Labels: map[string]string{WorkshopctlLabel: clusterName, RoleLabel: role}}
+	api.servers[s.ID] = s
+}
+
+// addLB adds the load balancer of the cluster
+func (api *fakeAPI) addLB(clusterName string) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	lb := schema.LoadBalancer{ID: api.id(), Name: clusterName, Labels: map[string]string{WorkshopctlLabel: clusterName}}
+	api.lbs[lb.ID] = lb
+}
+
+// matchesSelector supports the "key" and "key=value" label selectors, separated by commas
+func matchesSelector(labels map[string]string, selector string) bool {
+	if len(selector) == 0 {
+		return true
+	}
+	for _, req := range strings.Split(selector, ",") {
+		kv := strings.SplitN(req, "=", 2)
+		value, ok := labels[kv[0]]
+		if !ok || (len(kv) == 2 && value != kv[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestProvider(t *testing.T, ctx context.Context, endpoint string) *HetznerCloudProvider {
+	p, err := NewHetznerCloudProvider(ctx, &config.Provider{
+		Name:             "hetzner",
+		ServiceAccount:   config.ServiceAccount{ServiceAccountContent: "token"},
+		ProviderSpecific: map[string]string{EndpointKey: endpoint},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*HetznerCloudProvider)
+}
+
+func TestCreateCluster(t *testing.T) {
+	api, srv := newFakeAPI(t)
+	// The API server never gets ready, as k3s isn't running. Waiting for it is cut short by the
+	// deadline, after which all resources have been requested.
+	ctx, cancel := context.WithTimeout(util.WithDryRun(context.Background(), false), 3*time.Second)
+	defer cancel()
+	hz := newTestProvider(t, ctx, srv.URL)
+
+	m := provider.ClusterMeta{NamePrefix: "test", Index: 1}
+	_, err := hz.CreateCluster(ctx, m, provider.ClusterSpec{
+		Version:    "1.29.2",
+		RootDomain: provider.FormatRootDomain("workshops.example.com"),
+		NodeGroups: []config.NodeGroup{
+			{Instances: 2, NodeClaim: config.NodeClaim{CPU: 2, RAM: 4}},
+			{Instances: 1, NodeClaim: config.NodeClaim{CPU: 4, RAM: 16, Dedicated: true}},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected waiting for the API server to fail")
+	}
+
+	if len(api.lbs) != 1 {
+		t.Fatalf("expected one load balancer, got %d", len(api.lbs))
+	}
+	for _, lb := range api.lbs {
+		if lb.Name != m.Name() || lb.Labels[WorkshopctlLabel] != m.Name() {
+			t.Errorf("unexpected load balancer %s with labels %v", lb.Name, lb.Labels)
+		}
+	}
+
+	want := map[string]struct{ role, serverType string }{
+		m.Name() + "-nodepool-01-1": {roleServer, "cx22"},
+		m.Name() + "-nodepool-01-2": {roleAgent, "cx22"},
+		m.Name() + "-nodepool-02-1": {roleAgent, "ccx23"},
+	}
+	if len(api.servers) != len(want) {
+		t.Fatalf("expected %d servers, got %d", len(want), len(api.servers))
+	}
+	for _, s := range api.servers {
+		w, ok := want[s.Name]
+		if !ok {
+			t.Errorf("unexpected server %s", s.Name)
+			continue
+		}
+		if s.Labels[provider.RootDomainKey] != "workshops_example_com" {
+			t.Errorf("server %s: expected the root domain label, got labels %v", s.Name, s.Labels)
+		}
+		if s.Labels[RoleLabel] != w.role || s.Labels[WorkshopctlLabel] != m.Name() || s.ServerType.Name != w.serverType {
+			t.Errorf("server %s: expected role %s and type %s, got labels %v and type %s", s.Name, w.role, w.serverType, s.Labels, s.ServerType.Name)
+		}
+	}
+}
+
+func TestCreateClusterExists(t *testing.T) {
+	api, srv := newFakeAPI(t)
+	ctx := util.WithDryRun(context.Background(), false)
+	hz := newTestProvider(t, ctx, srv.URL)
+
+	m := provider.ClusterMeta{NamePrefix: "test", Index: 1}
+	api.addServer(m.Name(), m.Name()+"-nodepool-01-1", roleServer)
+
+	_, err := hz.CreateCluster(ctx, m, provider.ClusterSpec{
+		NodeGroups: []config.NodeGroup{{Instances: 1, NodeClaim: config.NodeClaim{CPU: 2, RAM: 4}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected an already exists error, got %v", err)
+	}
+	if len(api.lbs) != 0 || len(api.servers) != 1 {
+		t.Errorf("expected nothing to be created, got %d load balancers and %d servers", len(api.lbs), len(api.servers))
+	}
+}
+
+func TestDeleteCluster(t *testing.T) {
+	api, srv := newFakeAPI(t)
+	ctx := util.WithDryRun(context.Background(), false)
+	hz := newTestProvider(t, ctx, srv.URL)
+
+	m := provider.ClusterMeta{NamePrefix: "test", Index: 1}
+	other := provider.ClusterMeta{NamePrefix: "test", Index: 2}
+	for _, cm := range []provider.ClusterMeta{m, other} {
+		api.addLB(cm.Name())
+		api.addServer(cm.Name(), cm.Name()+"-nodepool-01-1", roleServer)
+		api.addServer(cm.Name(), cm.Name()+"-nodepool-01-2", roleAgent)
+	}
+
+	if err := hz.DeleteCluster(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	// The load balancer goes first, so that it doesn't route to servers being deleted
+	if len(api.deleted) != 3 || api.deleted[0] != "load balancer/"+m.Name() {
+		t.Fatalf("expected the load balancer and then two servers to be deleted, got %v", api.deleted)
+	}
+	for _, d := range api.deleted[1:] {
+		if !strings.HasPrefix(d, fmt.Sprintf("server/%s-", m.Name())) {
+			t.Errorf("unexpected deletion of %s", d)
+		}
+	}
+	if len(api.lbs) != 1 || len(api.servers) != 2 {
+		t.Errorf("expected the other cluster to be kept, got %d load balancers and %d servers", len(api.lbs), len(api.servers))
+	}
+
+	// The cluster is gone now
+	if err := hz.DeleteCluster(ctx, m); !errors.Is(err, clusterNotFound) {
+		t.Errorf("expected clusterNotFound, got %v", err)
+	}
+}
+
+func TestChooseServerType(t *testing.T) {
+	_, srv := newFakeAPI(t)
+	ctx := util.WithDryRun(context.Background(), false)
+	hz := newTestProvider(t, ctx, srv.URL)
+	serverTypes, err := hz.serverTypeCatalog(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for claim, want := range map[config.NodeClaim]string{
+		{CPU: 2, RAM: 4}:                   "cx22",
+		{CPU: 3, RAM: 2}:                   "cpx21",
+		{CPU: 2, RAM: 6}:                   "cx32",
+		{CPU: 1, RAM: 1, Dedicated: true}:  "ccx13",
+		{CPU: 4, RAM: 16, Dedicated: true}: "ccx23",
+	} {
+		st, err := chooseServerType(serverTypes, DefaultLocation, claim)
+		if err != nil {
+			t.Errorf("%s: %v", claimStr(claim), err)
+			continue
+		}
+		if st.Name != want {
+			t.Errorf("%s: expected %s, got %s", claimStr(claim), want, st.Name)
+		}
+		if got := claimForServerType(st); got.Dedicated != claim.Dedicated || got.CPU < claim.CPU || got.RAM < claim.RAM {
+			t.Errorf("%s: %s has %s", claimStr(claim), st.Name, claimStr(got))
+		}
+	}
+
+	// Nothing fits, or the location doesn't offer the server types
+	if _, err := chooseServerType(serverTypes, DefaultLocation, config.NodeClaim{CPU: 8, RAM: 32, Dedicated: true}); err == nil {
+		t.Error("expected an error when no server type is large enough")
+	}
+	if _, err := chooseServerType(serverTypes, "fsn1", config.NodeClaim{CPU: 2, RAM: 4}); err == nil {
+		t.Error("expected an error when no server type is available in the location")
+	}
+}
+
+func TestGetKubeconfig(t *testing.T) {
+	_, srv := newFakeAPI(t)
+	ctx := util.WithDryRun(context.Background(), false)
+	hz := newTestProvider(t, ctx, srv.URL)
+
+	if _, err := hz.GetKubeconfig(ctx, provider.ClusterMeta{NamePrefix: "test", Index: 1}); !errors.Is(err, provider.ErrKubeconfigUnrecoverable) {
+		t.Errorf("expected ErrKubeconfigUnrecoverable, got %v", err)
+	}
+}
+
+func TestDeleteClusterDryRun(t *testing.T) {
+	api, srv := newFakeAPI(t)
+	ctx := util.WithDryRun(context.Background(), true)
+	hz := newTestProvider(t, ctx, srv.URL)
+
+	m := provider.ClusterMeta{NamePrefix: "test", Index: 1}
+	api.addLB(m.Name())
+	api.addServer(m.Name(), m.Name()+"-nodepool-01-1", roleServer)
+
+	if err := hz.DeleteCluster(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.deleted) != 0 {
+		t.Errorf("expected nothing to be deleted when dry-running, got %v", api.deleted)
+	}
+}
@@ -0,0 +1,311 @@
+package hetzner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+const (
+	// k3s reads pre-created CAs from this directory on first start. This allows us to create
+	// a kubeconfig without ever having to SSH into the server.
+	k3sTLSDir = "/var/lib/rancher/k3s/server/tls"
+	// apiServerPort is the port of the Kubernetes API server, both on the server and the LB
+	apiServerPort = 6443
+	// caValidity is how long the generated certificates are valid. Workshop clusters are short-lived.
+	caValidity = 365 * 24 * time.Hour
+)
+
+// k3sPKI contains the certificates and keys needed to bootstrap k3s and access it afterwards
+type k3sPKI struct {
+	ServerCA  *certKeyPair
+	ClientCA  *certKeyPair
+	AdminCert *certKeyPair
+	// Token is the shared secret agents use to join the server
+	Token string
+}
+
+type certKeyPair struct {
+	cert    *x509.Certificate
+	CertPEM []byte
+	KeyPEM  []byte
+	key     *ecdsa.PrivateKey
+}
+
+func newK3sPKI() (*k3sPKI, error) {
+	serverCA, err := newCertKeyPair("k3s-server-ca", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	clientCA, err := newCertKeyPair("k3s-client-ca", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Members of system:masters are cluster-admin
+	adminCert, err := newCertKeyPair("workshopctl-admin", []string{"system:masters"}, clientCA)
+	if err != nil {
+		return nil, err
+	}
+	token, err := util.RandomSHA(32)
+	if err != nil {
+		return nil, err
+	}
+	return &k3sPKI{
+		ServerCA:  serverCA,
+		ClientCA:  clientCA,
+		AdminCert: adminCert,
+		Token:     token,
+	}, nil
+}
+
+// newCertKeyPair creates a CA if parent is nil, otherwise a client certificate signed by parent
+func newCertKeyPair(commonName string, organizations []string, parent *certKeyPair) (*certKeyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: organizations,
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		BasicConstraintsValid: true,
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	} else {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &certKeyPair{
+		cert:    cert,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		key:     key,
+	}, nil
+}
+
+// httpClient returns a client that trusts the server CA and authenticates as the admin
+func (p *k3sPKI) httpClient() (*http.Client, error) {
+	clientCert, err := tls.X509KeyPair(p.AdminCert.CertPEM, p.AdminCert.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(p.ServerCA.cert)
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:      pool,
+				Certificates: []tls.Certificate{clientCert},
+			},
+		},
+	}, nil
+}
+
+const kubeconfigTmpl = `apiVersion: v1
+kind: Config
+clusters:
+- name: {{ .Name }}
+  cluster:
+    server: {{ .Server }}
+    certificate-authority-data: {{ .CA }}
+users:
+- name: {{ .Name }}-admin
+  user:
+    client-certificate-data: {{ .Cert }}
+    client-key-data: {{ .Key }}
+contexts:
+- name: {{ .Name }}
+  context:
+    cluster: {{ .Name }}
+    user: {{ .Name }}-admin
+current-context: {{ .Name }}
+`
+
+func (p *k3sPKI) kubeconfig(clusterName string, endpoint net.IP) ([]byte, error) {
+	kubeconfig, err := applyTemplate(kubeconfigTmpl, map[string]string{
+		"Name":   clusterName,
+		"Server": apiServerURL(endpoint),
+		"CA":     base64.StdEncoding.EncodeToString(p.ServerCA.CertPEM),
+		"Cert":   base64.StdEncoding.EncodeToString(p.AdminCert.CertPEM),
+		"Key":    base64.StdEncoding.EncodeToString(p.AdminCert.KeyPEM),
+	})
+	return []byte(kubeconfig), err
+}
+
+func apiServerURL(endpoint net.IP) string {
+	return fmt.Sprintf("https://%s", net.JoinHostPort(endpoint.String(), fmt.Sprintf("%d", apiServerPort)))
+}
+
+const cloudInitTmpl = `#cloud-config
+{{- if .Server }}
+write_files:
+- path: {{ .TLSDir }}/server-ca.crt
+  encoding: b64
+  content: {{ .ServerCACert }}
+- path: {{ .TLSDir }}/server-ca.key
+  encoding: b64
+  permissions: "0600"
+  content: {{ .ServerCAKey }}
+- path: {{ .TLSDir }}/client-ca.crt
+  encoding: b64
+  content: {{ .ClientCACert }}
+- path: {{ .TLSDir }}/client-ca.key
+  encoding: b64
+  permissions: "0600"
+  content: {{ .ClientCAKey }}
+{{- end }}
+runcmd:
+- curl -sfL https://get.k3s.io | {{ .InstallEnv }} K3S_TOKEN={{ .Token }} sh -s - {{ .Args }}
+`
+
+// cloudInit returns the user data that installs k3s on a server. The first node runs the k3s
+// server, using the pre-created CAs. All other nodes join it as agents through the load balancer.
+// The node gets the labels and taints of its node group.
+func (p *k3sPKI) cloudInit(server bool, version string, endpoint net.IP, ng config.NodeGroup) (string, error) {
+	// "latest" maps to the k3s release channel of the same name, everything else is treated as
+	// an exact k3s version, e.g. "v1.29.3+k3s1".
+	installEnv := "INSTALL_K3S_CHANNEL=latest"
+	if len(version) != 0 && version != "latest" {
+		installEnv = fmt.Sprintf("INSTALL_K3S_VERSION=%s", version)
+	}
+
+	args := "agent"
+	if server {
+		// workshopctl installs its own Traefik, hence disable the built-in one
+		args = fmt.Sprintf("server --disable=traefik --tls-san=%s", endpoint)
+	} else {
+		installEnv += fmt.Sprintf(" K3S_URL=%s", apiServerURL(endpoint))
+	}
+	// The labels and taints are validated to not contain any characters the shell would interpret.
+	// They are sorted, so that the user data is the same for all nodes of the node group.
+	nodeArgs := []string{}
+	for k, v := range ng.Labels {
+		nodeArgs = append(nodeArgs, fmt.Sprintf("--node-label=%s=%s", k, v))
+	}
+	sort.Strings(nodeArgs)
+	for _, t := range ng.Taints {
+		nodeArgs = append(nodeArgs, fmt.Sprintf("--node-taint=%s", t))
+	}
+	if len(nodeArgs) != 0 {
+		args += " " + strings.Join(nodeArgs, " ")
+	}
+
+	return applyTemplate(cloudInitTmpl, map[string]interface{}{
+		"Server":       server,
+		"TLSDir":       k3sTLSDir,
+		"ServerCACert": base64.StdEncoding.EncodeToString(p.ServerCA.CertPEM),
+		"ServerCAKey":  base64.StdEncoding.EncodeToString(p.ServerCA.KeyPEM),
+		"ClientCACert": base64.StdEncoding.EncodeToString(p.ClientCA.CertPEM),
+		"ClientCAKey":  base64.StdEncoding.EncodeToString(p.ClientCA.KeyPEM),
+		"InstallEnv":   installEnv,
+		"Token":        p.Token,
+		"Args":         args,
+	})
+}
+
+// k3sChannelsURL lists the k3s release channels. Each channel, e.g. "latest", "stable" or "v1.29",
+// points to the newest k3s version of that channel.
+const k3sChannelsURL = "https://update.k3s.io/v1-release/channels"
+
+type k3sChannels struct {
+	Data []struct {
+		Name   string `json:"name"`
+		Latest string `json:"latest"`
+	} `json:"data"`
+}
+
+// ResolveVersion returns the newest k3s version of the release channel matching version. Exact
+// k3s versions, e.g. "v1.29.3+k3s1", are returned as-is.
+func (hz *HetznerCloudProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	if strings.Contains(version, "+k3s") {
+		return version, nil
+	}
+	channel := version
+	if version != config.LatestKubernetesVersion {
+		channel = "v" + strings.TrimPrefix(version, "v")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k3sChannelsURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("listing k3s release channels failed: %s", resp.Status)
+	}
+	channels := k3sChannels{}
+	if err := json.NewDecoder(resp.Body).Decode(&channels); err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(channels.Data))
+	for _, c := range channels.Data {
+		if c.Name == channel {
+			return c.Latest, nil
+		}
+		names = append(names, c.Name)
+	}
+	return "", fmt.Errorf("Kubernetes version %q doesn't match any k3s release channel, use an exact k3s version like v1.29.3+k3s1, or one of %s",
+		version, strings.Join(names, ", "))
+}
+
+// applyTemplate is like util.ApplyTemplate, but without HTML escaping, which would
+// break e.g. k3s versions like "v1.29.3+k3s1".
+func applyTemplate(tmpl string, data interface{}) (string, error) {
+	buf := &strings.Builder{}
+	if err := template.Must(template.New("tmpl").Parse(tmpl)).Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,112 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/hetznercloud/hcloud-go/hcloud"
+)
+
+// serverTypeCatalog returns all server types. The catalog is fetched once per provider, as it is
+// the same for all clusters.
+func (hz *HetznerCloudProvider) serverTypeCatalog(ctx context.Context) ([]*hcloud.ServerType, error) {
+	hz.serverTypesMux.Lock()
+	defer hz.serverTypesMux.Unlock()
+	if hz.serverTypes != nil {
+		return hz.serverTypes, nil
+	}
+
+	serverTypes, err := hz.c.ServerType.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hz.serverTypes = serverTypes
+	return serverTypes, nil
+}
+
+// chooseServerType returns the cheapest server type available in the location that has at least
+// the CPUs and RAM of the claim. If the claim is dedicated, only server types with dedicated CPUs
+// are considered.
+func chooseServerType(serverTypes []*hcloud.ServerType, location string, c config.NodeClaim) (*hcloud.ServerType, error) {
+	type candidate struct {
+		serverType *hcloud.ServerType
+		price      float64
+	}
+	candidates := []candidate{}
+	for _, st := range serverTypes {
+		if st.Cores < int(c.CPU) || st.Memory < float32(c.RAM) {
+			continue
+		}
+		if c.Dedicated && st.CPUType != hcloud.CPUTypeDedicated {
+			continue
+		}
+		pricing, ok := locationPricing(st, location)
+		if !ok {
+			continue
+		}
+		price, err := strconv.ParseFloat(pricing.Hourly.Gross, 64)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate{st, price})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no server type in location %s has at least %s", location, claimStr(c))
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].price != candidates[j].price {
+			return candidates[i].price < candidates[j].price
+		}
+		// For the same price, prefer the bigger server type
+		return candidates[i].serverType.Memory > candidates[j].serverType.Memory
+	})
+	return candidates[0].serverType, nil
+}
+
+// chooseServerTypes returns the server types for the node groups
+func (hz *HetznerCloudProvider) chooseServerTypes(ctx context.Context, nodeGroups []config.NodeGroup) ([]*hcloud.ServerType, error) {
+	serverTypes, err := hz.serverTypeCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chosen := make([]*hcloud.ServerType, 0, len(nodeGroups))
+	for i, ng := range nodeGroups {
+		st, err := chooseServerType(serverTypes, hz.location, ng.NodeClaim)
+		if err != nil {
+			return nil, fmt.Errorf("node group %d: %w", i+1, err)
+		}
+		chosen = append(chosen, st)
+	}
+	return chosen, nil
+}
+
+// claimForServerType is the inverse of chooseServerType
+func claimForServerType(st *hcloud.ServerType) config.NodeClaim {
+	return config.NodeClaim{
+		CPU:       uint16(st.Cores),
+		RAM:       uint16(st.Memory),
+		Dedicated: st.CPUType == hcloud.CPUTypeDedicated,
+	}
+}
+
+// locationPricing returns the prices of the server type in the location, if it's available there
+func locationPricing(st *hcloud.ServerType, location string) (hcloud.ServerTypeLocationPricing, bool) {
+	for _, p := range st.Pricings {
+		if p.Location != nil && p.Location.Name == location {
+			return p, true
+		}
+	}
+	return hcloud.ServerTypeLocationPricing{}, false
+}
+
+func claimStr(c config.NodeClaim) string {
+	s := fmt.Sprintf("%d CPUs and %dGB RAM", c.CPU, c.RAM)
+	if c.Dedicated {
+		s += " (dedicated)"
+	}
+	return s
+}
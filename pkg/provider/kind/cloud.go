@@ -0,0 +1,275 @@
+package kind
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// NodeImageKey allows overriding the whole kind node image, e.g. for air-gapped rehearsals
+	NodeImageKey = "nodeImage"
+	// The node image repository; ClusterSpec.Version is used as the tag
+	nodeImageRepo = "kindest/node"
+)
+
+// defaultNodeImageRegexp matches the default node image reference in the kind binary, e.g.
+// "kindest/node:v1.29.2@sha256:<digest>"
+var defaultNodeImageRegexp = regexp.MustCompile(`kindest/node:v(\d+\.\d+\.\d+)@sha256:[0-9a-f]{64}`)
+
+// NewKindCloudProvider returns a provider that creates local kind clusters, for rehearsals and CI.
+// Services of type LoadBalancer, like Traefik's, need a LoadBalancer implementation such as
+// cloud-provider-kind to be running on the host.
+func NewKindCloudProvider(ctx context.Context, p *config.Provider) (provider.CloudProvider, error) {
+	return &KindCloudProvider{
+		nodeImage: p.ProviderSpecific[NodeImageKey],
+	}, nil
+}
+
+type KindCloudProvider struct {
+	nodeImage string
+}
+
+type kindConfig struct {
+	Kind       string     `json:"kind"`
+	APIVersion string     `json:"apiVersion"`
+	Nodes      []kindNode `json:"nodes"`
+}
+
+type kindNode struct {
+	Role                 string            `json:"role"`
+	Image                string            `json:"image,omitempty"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	KubeadmConfigPatches []string          `json:"kubeadmConfigPatches,omitempty"`
+}
+
+// taintsPatch returns the kubeadm config patch that registers a worker node with the taints
+func taintsPatch(taints []config.Taint) (string, error) {
+	patch := struct {
+		Kind             string `json:"kind"`
+		NodeRegistration struct {
+			Taints []config.Taint `json:"taints"`
+		} `json:"nodeRegistration"`
+	}{Kind: "JoinConfiguration"}
+	patch.NodeRegistration.Taints = taints
+	b, err := yaml.Marshal(patch)
+	return string(b), err
+}
+
+func (k *KindCloudProvider) CreateCluster(ctx context.Context, m provider.ClusterMeta, c provider.ClusterSpec) (*provider.Cluster, error) {
+	logger := util.Logger(ctx)
+
+	start := time.Now().UTC()
+	cluster := &provider.Cluster{
+		ClusterMeta: m,
+		Spec:        c,
+		Status: provider.ClusterStatus{
+			ID:             m.Name(),
+			ProvisionStart: &start,
+		},
+	}
+
+	exists, err := k.clusterExists(ctx, cluster.Name())
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		logger.Infof("Found existing kind cluster with name %q", cluster.Name())
+	} else {
+		if err := k.createCluster(ctx, cluster); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Infof("Getting KubeConfig...")
+	kubeconfig, _, err := util.Command(ctx, "kind", "get", "kubeconfig", "--name", cluster.Name()).Run()
+	if err != nil {
+		return nil, err
+	}
+	cluster.Status.KubeconfigBytes = []byte(kubeconfig + "\n")
+
+	if endpoint, err := provider.KubeconfigServer(cluster.Status.KubeconfigBytes); err == nil {
+		cluster.Status.EndpointURL = endpoint
+		cluster.Status.EndpointIP = net.ParseIP(endpoint.Hostname())
+	}
+	now := time.Now().UTC()
+	cluster.Status.ProvisionDone = &now
+	return cluster, nil
+}
+
+func (k *KindCloudProvider) createCluster(ctx context.Context, cluster *provider.Cluster) error {
+	logger := util.Logger(ctx)
+
+	image := k.nodeImage
+	if len(image) == 0 && len(cluster.Spec.Version) != 0 && cluster.Spec.Version != "latest" {
+		// Node images are only tagged with exact versions, e.g. "v1.29.2"
+		version, err := utilversion.ParseSemantic(cluster.Spec.Version)
+		if err != nil {
+			return fmt.Errorf("kind needs either \"latest\" or an exact Kubernetes version like 1.29.2, got %q", cluster.Spec.Version)
+		}
+		image = fmt.Sprintf("%s:v%s", nodeImageRepo, version)
+	}
+
+	// Every node group instance becomes a worker, in addition to the control plane node
+	cfg := kindConfig{
+		Kind:       "Cluster",
+		APIVersion: "kind.x-k8s.io/v1alpha4",
+		Nodes:      []kindNode{{Role: "control-plane", Image: image}},
+	}
+	for i, ng := range cluster.Spec.NodeGroups {
+		if ng.Autoscales() {
+			logger.Warnf("kind can't autoscale node groups, hence node group %d gets a fixed %d nodes", i+1, ng.Instances)
+		}
+		node := kindNode{Role: "worker", Image: image, Labels: ng.Labels}
+		if len(ng.Taints) != 0 {
+			patch, err := taintsPatch(ng.Taints)
+			if err != nil {
+				return err
+			}
+			node.KubeadmConfigPatches = []string{patch}
+		}
+		for j := uint16(0); j < ng.Instances; j++ {
+			cfg.Nodes = append(cfg.Nodes, node)
+		}
+	}
+	cfgBytes, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	util.DebugObject(ctx, "kind cluster config", cfg)
+
+	// Don't let kind touch the user's ~/.kube/config, instead write to a temporary file
+	tmpKubeconfig, err := ioutil.TempFile("", "workshopctl-kind-")
+	if err != nil {
+		return err
+	}
+	tmpKubeconfig.Close()
+	defer os.Remove(tmpKubeconfig.Name())
+
+	logger.Infof("Creating new kind cluster with name %s", cluster.Name())
+	_, _, err = util.Command(ctx, "kind", "create", "cluster",
+		"--name", cluster.Name(),
+		"--config", "-",
+		"--kubeconfig", tmpKubeconfig.Name(),
+		"--wait", "5m",
+	).WithStdio(strings.NewReader(string(cfgBytes)), nil, nil).Run()
+	return err
+}
+
+func (k *KindCloudProvider) DeleteCluster(ctx context.Context, m provider.ClusterMeta) error {
+	logger := util.Logger(ctx)
+
+	exists, err := k.clusterExists(ctx, m.Name())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		logger.Infof("kind cluster %s doesn't exist, nothing to delete", m.Name())
+		return nil
+	}
+
+	logger.Infof("Deleting kind cluster %s", m.Name())
+	_, _, err = util.Command(ctx, "kind", "delete", "cluster", "--name", m.Name()).Run()
+	return err
+}
+
+func (k *KindCloudProvider) GetKubeconfig(ctx context.Context, m provider.ClusterMeta) ([]byte, error) {
+	kubeconfig, _, err := util.ReadOnlyCommand(ctx, "kind", "get", "kubeconfig", "--name", m.Name()).Run()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(kubeconfig + "\n"), nil
+}
+
+// ResolveVersion makes sure version can be used as the tag of the node image. "latest" resolves to
+// the version of the default node image of the installed kind binary.
+func (k *KindCloudProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	if len(k.nodeImage) != 0 {
+		return version, nil
+	}
+	if version == config.LatestKubernetesVersion {
+		return defaultNodeImageVersion()
+	}
+	if _, err := utilversion.ParseSemantic(version); err != nil {
+		return "", fmt.Errorf("kind needs either %q or an exact Kubernetes version like 1.29.2, got %q", config.LatestKubernetesVersion, version)
+	}
+	return version, nil
+}
+
+// defaultNodeImageVersion returns the Kubernetes version of the node image kind uses by default.
+// kind has no command printing it, but its binary embeds the image reference.
+func defaultNodeImageVersion() (string, error) {
+	path, err := exec.LookPath("kind")
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	match := defaultNodeImageRegexp.FindSubmatch(b)
+	if match == nil {
+		return "", fmt.Errorf("couldn't find the default node image in %q, set an exact Kubernetes version like 1.29.2 or the %s provider setting instead", path, NodeImageKey)
+	}
+	return string(match[1]), nil
+}
+
+// ListClusters returns the kind clusters with the given prefix. kind doesn't tell how large
+// its nodes are, hence Spec.NodeGroups is nil.
+func (k *KindCloudProvider) ListClusters(ctx context.Context, namePrefix string) ([]*provider.Cluster, error) {
+	names, err := k.listClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clusters := []*provider.Cluster{}
+	for _, name := range names {
+		if m, ok := provider.ParseClusterName(namePrefix, name); ok {
+			clusters = append(clusters, &provider.Cluster{
+				ClusterMeta: m,
+				Status: provider.ClusterStatus{
+					ID: name,
+				},
+			})
+		}
+	}
+	return clusters, nil
+}
+
+func (k *KindCloudProvider) clusterExists(ctx context.Context, name string) (bool, error) {
+	names, err := k.listClusters(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		if n == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (k *KindCloudProvider) listClusters(ctx context.Context) ([]string, error) {
+	out, _, err := util.ReadOnlyCommand(ctx, "kind", "get", "clusters").Run()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if name := strings.TrimSpace(line); len(name) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,127 @@
+package kind
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/gen"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+const (
+	HostsFileKey     = "hostsFile"
+	DefaultHostsFile = "/etc/hosts"
+
+	// Every entry managed by workshopctl ends with this marker followed by the cluster domain
+	hostsMarker = "# workshopctl:"
+)
+
+// hostPrefixes are the sub-domains of the cluster domain that get an entry, in addition to the
+// cluster domain itself. /etc/hosts doesn't support wildcards, hence they need to be listed.
+var hostPrefixes = []string{"dashboard", "traefik"}
+
+// NewKindDNSProvider returns a provider that writes /etc/hosts style entries for local clusters,
+// instead of relying on a real DNS zone and external-dns.
+func NewKindDNSProvider(ctx context.Context, p *config.Provider, rootDomain string) (provider.DNSProvider, error) {
+	hostsFile := DefaultHostsFile
+	if f, ok := p.ProviderSpecific[HostsFileKey]; ok {
+		hostsFile = f
+	}
+	return &KindDNSProvider{
+		rootDomain: rootDomain,
+		hostsFile:  hostsFile,
+	}, nil
+}
+
+type KindDNSProvider struct {
+	rootDomain string
+	hostsFile  string
+}
+
+var _ provider.RecordsProvider = &KindDNSProvider{}
+
+func (k *KindDNSProvider) ChartProcessors() []gen.Processor {
+	return nil
+}
+
+func (k *KindDNSProvider) ValuesProcessors() []gen.Processor {
+	return nil
+}
+
+// EnsureZone makes sure the hosts file can be written to, there's no zone to create
+func (k *KindDNSProvider) EnsureZone(ctx context.Context) error {
+	if util.IsDryRun(ctx) {
+		util.Logger(ctx).Infof("Would make sure %s is writable", k.hostsFile)
+		return nil
+	}
+	f, err := os.OpenFile(k.hostsFile, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("%s must be writable for the kind DNS provider: %w", k.hostsFile, err)
+	}
+	return f.Close()
+}
+
+// EnsureRecords points the cluster's host names to ip
+func (k *KindDNSProvider) EnsureRecords(ctx context.Context, m provider.ClusterMeta, ip net.IP) error {
+	domain := m.Index.Domain(k.rootDomain)
+	entries := []string{k.entry(ip, domain)}
+	for _, prefix := range hostPrefixes {
+		entries = append(entries, k.entry(ip, fmt.Sprintf("%s.%s", prefix, domain)))
+	}
+	return k.updateHostsFile(ctx, domain, entries)
+}
+
+// CleanupRecords removes all entries of the cluster from the hosts file
+func (k *KindDNSProvider) CleanupRecords(ctx context.Context, m provider.ClusterMeta) error {
+	return k.updateHostsFile(ctx, m.Index.Domain(k.rootDomain), nil)
+}
+
+func (k *KindDNSProvider) entry(ip net.IP, host string) string {
+	return fmt.Sprintf("%s\t%s %s%s", ip, host, hostsMarker, host)
+}
+
+// updateHostsFile replaces all entries belonging to domain with the given entries
+func (k *KindDNSProvider) updateHostsFile(ctx context.Context, domain string, entries []string) error {
+	logger := util.Logger(ctx)
+
+	b, err := ioutil.ReadFile(k.hostsFile)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(string(b)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if k.ownedBy(line, domain) {
+			logger.Debugf("Removing hosts entry: %s", line)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		logger.Infof("Adding hosts entry: %s", entry)
+	}
+	lines = append(lines, entries...)
+	return util.WriteFile(ctx, k.hostsFile, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// ownedBy tells whether the hosts file line is an entry for domain, or a sub-domain of it
+func (k *KindDNSProvider) ownedBy(line, domain string) bool {
+	i := strings.Index(line, hostsMarker)
+	if i == -1 {
+		return false
+	}
+	host := strings.TrimSpace(line[i+len(hostsMarker):])
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
@@ -2,13 +2,18 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cloud-native-nordics/workshopctl/pkg/config"
 	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
 	"github.com/cloud-native-nordics/workshopctl/pkg/gen"
+	"sigs.k8s.io/yaml"
 )
 
 type Cluster struct {
@@ -26,9 +31,77 @@ func (m ClusterMeta) Name() string {
 	return constants.ClusterName(m.NamePrefix, m.Index)
 }
 
+// ParseClusterName is the inverse of ClusterMeta.Name(). ok is false if name isn't the
+// name of a cluster with the given prefix. If namePrefix is empty, the clusters of all
+// workshops match.
+func ParseClusterName(namePrefix, name string) (m ClusterMeta, ok bool) {
+	if namePrefix == "" {
+		// The name prefix is what is between "workshopctl-" and the last dash
+		rest := strings.TrimPrefix(name, strings.TrimSuffix(constants.ClusterNamePrefix(""), "-"))
+		i := strings.LastIndex(rest, "-")
+		if rest == name || i < 1 {
+			return ClusterMeta{}, false
+		}
+		return ParseClusterName(rest[:i], name)
+	}
+	prefix := constants.ClusterNamePrefix(namePrefix)
+	if !strings.HasPrefix(name, prefix) {
+		return ClusterMeta{}, false
+	}
+	i, err := strconv.ParseUint(strings.TrimPrefix(name, prefix), 10, 16)
+	if err != nil || i == 0 {
+		return ClusterMeta{}, false
+	}
+	m = ClusterMeta{
+		NamePrefix: namePrefix,
+		Index:      config.ClusterNumber(i),
+	}
+	// Only accept the canonical form, e.g. "01" but not "1"
+	return m, m.Name() == name
+}
+
 type ClusterSpec struct {
 	Version    string
 	NodeGroups []config.NodeGroup
+	// ExpiresAt is when the cluster should be deleted by "workshopctl reap". Nil means never.
+	ExpiresAt *time.Time
+	// RootDomain is the domain the DNS records of the cluster are under, as formatted by
+	// FormatRootDomain. "workshopctl reap" only cleans up the records under the root domain it's
+	// given when it matches.
+	RootDomain string
+}
+
+// ExpiresAtKey is the key of the tag or label that clusters are stamped with when they expire
+const ExpiresAtKey = "workshopctl-expires-at"
+
+// FormatExpiry formats the expiry as Unix seconds, which is valid as tag or label value at all
+// providers
+func FormatExpiry(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// ParseExpiry is the inverse of FormatExpiry. ok is false if s isn't a valid expiry.
+func ParseExpiry(s string) (t *time.Time, ok bool) {
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	expiry := time.Unix(secs, 0).UTC()
+	return &expiry, true
+}
+
+// RootDomainKey is the key of the tag or label that clusters are stamped with their root domain
+const RootDomainKey = "workshopctl-root-domain"
+
+// FormatRootDomain formats the root domain so that it's valid as tag or label value at all
+// providers. Tags can't contain dots, and labels are at most 63 characters, ending with an
+// alphanumeric character.
+func FormatRootDomain(domain string) string {
+	s := strings.ReplaceAll(domain, ".", "_")
+	if len(s) > 63 {
+		s = strings.TrimRight(s[:63], "_-")
+	}
+	return s
 }
 
 type ClusterStatus struct {
@@ -47,6 +120,30 @@ func (s ClusterStatus) ProvisionTime() time.Duration {
 	return s.ProvisionDone.Sub(*s.ProvisionStart)
 }
 
+type kubeconfigClusters struct {
+	Clusters []struct {
+		Cluster struct {
+			Server string `json:"server"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+}
+
+// KubeconfigServer returns the API server URL of the first cluster in the kubeconfig
+func KubeconfigServer(kubeconfig []byte) (*url.URL, error) {
+	kc := kubeconfigClusters{}
+	if err := yaml.Unmarshal(kubeconfig, &kc); err != nil {
+		return nil, err
+	}
+	if len(kc.Clusters) == 0 {
+		return nil, fmt.Errorf("no clusters in kubeconfig")
+	}
+	return url.Parse(kc.Clusters[0].Cluster.Server)
+}
+
+// ErrKubeconfigUnrecoverable is returned by GetKubeconfig if the provider can't fetch the
+// kubeconfig of an existing cluster again
+var ErrKubeconfigUnrecoverable = errors.New("its kubeconfig can't be recovered from the provider")
+
 type CloudProviderFactory interface {
 	NewCloudProvider(ctx context.Context, p *config.Provider) (CloudProvider, error)
 }
@@ -54,8 +151,67 @@ type CloudProviderFactory interface {
 type CloudProvider interface {
 	// CreateCluster creates a cluster. This call is _blocking_ until the cluster is properly provisioned
 	CreateCluster(ctx context.Context, m ClusterMeta, c ClusterSpec) (*Cluster, error)
-	// DeleteCluster deletes a cluster and its associated load balancers
+	// DeleteCluster deletes a cluster and its associated load balancers and volumes
 	DeleteCluster(ctx context.Context, m ClusterMeta) error
+	// GetKubeconfig returns the admin kubeconfig of an existing cluster, or ErrKubeconfigUnrecoverable
+	// if the provider can't tell it
+	GetKubeconfig(ctx context.Context, m ClusterMeta) ([]byte, error)
+	// ListClusters returns the existing clusters whose names have the given prefix, or the clusters
+	// of all workshops if the prefix is empty. Spec.NodeGroups is nil if the provider can't tell how
+	// the cluster's nodes are sized, and the Labels and Taints of the node groups are nil if the
+	// provider can't tell them.
+	ListClusters(ctx context.Context, namePrefix string) ([]*Cluster, error)
+	// ResolveVersion resolves the requested Kubernetes version, i.e. "latest", a minor version
+	// like "1.29" or an exact version, to the exact version that ClusterSpec.Version should be.
+	// If the version isn't available, the error lists the versions that are.
+	ResolveVersion(ctx context.Context, version string) (string, error)
+}
+
+// OrphansProvider is an optional interface for cloud providers that can find resources which
+// outlived the clusters they were created for, e.g. load balancers and volumes
+type OrphansProvider interface {
+	// ListOrphans returns the orphaned resources in the whole account
+	ListOrphans(ctx context.Context) ([]Orphan, error)
+	// DeleteOrphan deletes a resource returned by ListOrphans
+	DeleteOrphan(ctx context.Context, o Orphan) error
+}
+
+// Orphan is a cloud resource that outlived the cluster it was created for
+type Orphan struct {
+	// Kind is the kind of resource, e.g. "load balancer"
+	Kind string
+	ID   string
+	Name string
+	// Reason tells why the resource is considered orphaned
+	Reason string
+}
+
+// Hibernator is an optional interface for cloud providers that can scale the nodes of a cluster
+// down while it isn't used, e.g. between workshop days, and back up again. The cluster itself is
+// kept, and so are its state, DNS records and credentials.
+type Hibernator interface {
+	// Hibernate scales each node group of the cluster down to the least amount of nodes the
+	// provider allows
+	Hibernate(ctx context.Context, m ClusterMeta) error
+	// Resume scales the node groups back up to the instances in the spec. This call is _blocking_
+	// until the nodes are running.
+	Resume(ctx context.Context, m ClusterMeta, c ClusterSpec) error
+}
+
+// Pricer is an optional interface for cloud providers that can tell what clusters cost
+type Pricer interface {
+	// Prices returns the hourly prices of the nodes and load balancer of a cluster with the given spec
+	Prices(ctx context.Context, c ClusterSpec) (*Prices, error)
+}
+
+// Prices are hourly prices in the given currency
+type Prices struct {
+	Currency string
+	// NodeGroups has the price of one node of each node group, in the same order as
+	// ClusterSpec.NodeGroups
+	NodeGroups []float64
+	// LoadBalancer is the price of the load balancer each cluster gets
+	LoadBalancer float64
 }
 
 type DNSProviderFactory interface {
@@ -68,6 +224,21 @@ type DNSProvider interface {
 	// EnsureZone ensures that the root domain zone is registered with the DNS provider
 	// This is run at apply-time before the individual cluster processors
 	EnsureZone(ctx context.Context) error
-	// CleanupRecords deletes records associated with a cluster
+	// CleanupRecords deletes records associated with a cluster. Callers hold the util.LockDNS lock.
 	CleanupRecords(ctx context.Context, m ClusterMeta) error
 }
+
+// RecordsProvider is an optional interface for DNS providers whose records aren't created by
+// external-dns in-cluster. Instead, workshopctl creates the records at apply-time, as soon as
+// the ingress IP of the cluster is known.
+type RecordsProvider interface {
+	// EnsureRecords points the cluster domain and its sub-domains to ip. Callers hold the
+	// util.LockDNS lock.
+	EnsureRecords(ctx context.Context, m ClusterMeta, ip net.IP) error
+}
+
+// RecordsLister is an optional interface for DNS providers that can tell which records exist
+type RecordsLister interface {
+	// ListRecords returns the records under the cluster domain
+	ListRecords(ctx context.Context, m ClusterMeta) ([]DNSRecord, error)
+}
@@ -6,7 +6,13 @@ import (
 
 	"github.com/cloud-native-nordics/workshopctl/pkg/config"
 	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/byo"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/cloudflare"
 	"github.com/cloud-native-nordics/workshopctl/pkg/provider/digitalocean"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/hetzner"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/kind"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/rfc2136"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider/route53"
 )
 
 func CloudProviders() provider.CloudProviderFactory {
@@ -25,10 +31,17 @@ type dnsFunc func(ctx context.Context, p *config.Provider, rootDomain string) (p
 
 var cloudProviders = map[string]cloudFunc{
 	"digitalocean": digitalocean.NewDigitalOceanCloudProvider,
+	"hetzner":      hetzner.NewHetznerCloudProvider,
+	"kind":         kind.NewKindCloudProvider,
+	"byo":          byo.NewBYOCloudProvider,
 }
 
 var dnsProviders = map[string]dnsFunc{
 	"digitalocean": digitalocean.NewDigitalOceanDNSProvider,
+	"kind":         kind.NewKindDNSProvider,
+	"cloudflare":   cloudflare.NewCloudflareDNSProvider,
+	"aws":          route53.NewRoute53DNSProvider,
+	"rfc2136":      rfc2136.NewRFC2136DNSProvider,
 }
 
 type providersImpl struct{}
@@ -0,0 +1,319 @@
+package rfc2136
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/config/keyval"
+	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+	"github.com/cloud-native-nordics/workshopctl/pkg/gen"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/miekg/dns"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// NameserverKey is the host:port of the authoritative DNS server accepting dynamic updates
+	NameserverKey = "nameserver"
+	// ZoneKey is the zone to update, defaults to the root domain
+	ZoneKey = "zone"
+	// TSIGKeyNameKey is the name of the TSIG key, e.g. "workshopctl."
+	TSIGKeyNameKey = "tsigKeyName"
+	// TSIGAlgorithmKey is the TSIG algorithm, e.g. "hmac-sha256"
+	TSIGAlgorithmKey = "tsigAlgorithm"
+
+	DefaultPort          = "53"
+	DefaultTSIGAlgorithm = "hmac-sha256"
+
+	// tsigFudge is the allowed clock skew between workshopctl and the nameserver
+	tsigFudge = 300
+)
+
+// deletableTypes are the record types that external-dns manages
+var deletableTypes = map[uint16]bool{
+	dns.TypeA:     true,
+	dns.TypeAAAA:  true,
+	dns.TypeCNAME: true,
+	dns.TypeTXT:   true,
+}
+
+// NewRFC2136DNSProvider returns a DNS provider for self-hosted authoritative DNS servers, e.g.
+// BIND or Knot, using dynamic updates (RFC 2136) signed by TSIG (RFC 2845). The service account
+// must contain the base64-encoded TSIG secret. The key needs to be allowed to both update and
+// transfer (AXFR) the zone, as that is how records are listed.
+func NewRFC2136DNSProvider(ctx context.Context, p *config.Provider, rootDomain string) (provider.DNSProvider, error) {
+	nameserver, ok := p.ProviderSpecific[NameserverKey]
+	if !ok {
+		return nil, fmt.Errorf("the rfc2136 DNS provider requires .providerSpecific.%s to be set", NameserverKey)
+	}
+	host, port, err := net.SplitHostPort(nameserver)
+	if err != nil {
+		host, port = nameserver, DefaultPort
+	}
+	keyName, ok := p.ProviderSpecific[TSIGKeyNameKey]
+	if !ok {
+		return nil, fmt.Errorf("the rfc2136 DNS provider requires .providerSpecific.%s to be set", TSIGKeyNameKey)
+	}
+	algorithm := DefaultTSIGAlgorithm
+	if a, ok := p.ProviderSpecific[TSIGAlgorithmKey]; ok {
+		algorithm = a
+	}
+	zone := rootDomain
+	if z, ok := p.ProviderSpecific[ZoneKey]; ok {
+		zone = z
+	}
+	return &RFC2136DNSProvider{
+		nameserver: net.JoinHostPort(host, port),
+		host:       host,
+		port:       port,
+		zone:       fqdn(zone),
+		keyName:    fqdn(keyName),
+		algorithm:  strings.TrimSuffix(algorithm, "."),
+		secret:     p.ServiceAccountContent,
+		rootDomain: rootDomain,
+		dryRun:     util.IsDryRun(ctx),
+	}, nil
+}
+
+type RFC2136DNSProvider struct {
+	nameserver string
+	host       string
+	port       string
+	zone       string
+	keyName    string
+	algorithm  string
+	secret     string
+	rootDomain string
+	dryRun     bool
+}
+
+func (r *RFC2136DNSProvider) ChartProcessors() []gen.Processor {
+	return []gen.Processor{
+		&provider.DNSEnvProcessor{
+			TraefikEnv:     traefikDNSEnv(r.nameserver, r.keyName, r.algorithm),
+			ExternalDNSEnv: externalDNSEnvValue,
+		},
+		&externalDNSArgsProcessor{
+			Args: []string{
+				"--rfc2136-host=" + r.host,
+				"--rfc2136-port=" + r.port,
+				"--rfc2136-zone=" + strings.TrimSuffix(r.zone, "."),
+				"--rfc2136-tsig-keyname=" + r.keyName,
+				"--rfc2136-tsig-secret-alg=" + r.algorithm,
+				"--rfc2136-tsig-secret=$(RFC2136_TSIG_SECRET)",
+				"--rfc2136-tsig-axfr",
+			},
+		},
+	}
+}
+
+func (r *RFC2136DNSProvider) ValuesProcessors() []gen.Processor {
+	return nil
+}
+
+// EnsureZone checks that the nameserver is authoritative for the zone using an SOA query, and
+// that the zone contains the root domain. The zone is never created.
+func (r *RFC2136DNSProvider) EnsureZone(ctx context.Context) error {
+	logger := util.Logger(ctx)
+
+	if !isSubdomain(fqdn(r.rootDomain), r.zone) {
+		return fmt.Errorf("root domain %s isn't part of zone %s", r.rootDomain, r.zone)
+	}
+
+	logger.Debugf("Ensuring zone %s is served by %s", r.zone, r.nameserver)
+	msg := new(dns.Msg).SetQuestion(r.zone, dns.TypeSOA)
+	msg.RecursionDesired = false
+	resp, err := r.exchange(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if !resp.Authoritative {
+		return fmt.Errorf("%s isn't authoritative for zone %s", r.nameserver, r.zone)
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, r.zone) {
+			logger.Debugf("Zone exists: %s", soa)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s didn't return an SOA record for zone %s", r.nameserver, r.zone)
+}
+
+// ListRecords transfers the zone and returns the records under the cluster domain
+func (r *RFC2136DNSProvider) ListRecords(ctx context.Context, m provider.ClusterMeta) ([]provider.DNSRecord, error) {
+	logger := util.Logger(ctx)
+
+	clusterDomain := m.Index.Domain(r.rootDomain)
+	logger.Debugf("Transferring zone %s to find records for cluster domain %s", r.zone, clusterDomain)
+	msg := new(dns.Msg).SetAxfr(r.zone)
+	msg.SetTsig(r.keyName, r.tsigAlgorithm(), tsigFudge, time.Now().Unix())
+	transfer := &dns.Transfer{TsigSecret: r.tsigSecret()}
+	envelopes, err := transfer.In(msg, r.nameserver)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []provider.DNSRecord{}
+	for env := range envelopes {
+		if env.Error != nil {
+			return nil, fmt.Errorf("couldn't transfer zone %s from %s, make sure the TSIG key is allowed to do so: %w", r.zone, r.nameserver, env.Error)
+		}
+		for _, rr := range env.RR {
+			rec := toRecord(rr)
+			logger.Debugf("Observed record: %s", rec)
+			if provider.RecordBelongsTo(rec.Name, clusterDomain) {
+				records = append(records, rec)
+			}
+		}
+	}
+	return records, nil
+}
+
+func (r *RFC2136DNSProvider) CleanupRecords(ctx context.Context, m provider.ClusterMeta) error {
+	logger := util.Logger(ctx)
+
+	records, err := r.ListRecords(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	clusterDomain := m.Index.Domain(r.rootDomain)
+	if util.IsForce(ctx) {
+		logger.Warnf("Deleting all records under %s, also those not created by external-dns", clusterDomain)
+	} else {
+		records = provider.OwnedRecords(records, clusterDomain)
+	}
+
+	toDelete := []dns.RR{}
+	for _, rec := range records {
+		rr := rec.ProviderData.(dns.RR)
+		if !deletableTypes[rr.Header().Rrtype] {
+			continue
+		}
+		if r.dryRun {
+			logger.Infof("Would delete record: %s", rec)
+			continue
+		}
+		logger.Infof("Deleting record: %s", rec)
+		toDelete = append(toDelete, rr)
+	}
+	if len(toDelete) == 0 {
+		return nil
+	}
+
+	// All records are deleted in one atomic update
+	msg := new(dns.Msg).SetUpdate(r.zone)
+	msg.Remove(toDelete)
+	_, err = r.exchange(ctx, msg)
+	return err
+}
+
+// exchange sends the message to the nameserver over TCP, signed with the TSIG key, and fails
+// unless the nameserver responds successfully
+func (r *RFC2136DNSProvider) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	msg.SetTsig(r.keyName, r.tsigAlgorithm(), tsigFudge, time.Now().Unix())
+	c := &dns.Client{Net: "tcp", TsigSecret: r.tsigSecret()}
+	resp, _, err := c.ExchangeContext(ctx, msg, r.nameserver)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("%s responded %s to %s", r.nameserver, dns.RcodeToString[resp.Rcode], opStr(msg))
+	}
+	return resp, nil
+}
+
+func (r *RFC2136DNSProvider) tsigAlgorithm() string {
+	return fqdn(r.algorithm)
+}
+
+func (r *RFC2136DNSProvider) tsigSecret() map[string]string {
+	return map[string]string{r.keyName: r.secret}
+}
+
+// opStr describes the message for errors, e.g. "the SOA query for example.com."
+func opStr(msg *dns.Msg) string {
+	if msg.Opcode == dns.OpcodeUpdate {
+		return "the update of zone " + msg.Question[0].Name
+	}
+	return fmt.Sprintf("the %s query for %s", dns.TypeToString[msg.Question[0].Qtype], msg.Question[0].Name)
+}
+
+// toRecord converts the resource record, keeping it as ProviderData for deleting it later
+func toRecord(rr dns.RR) provider.DNSRecord {
+	hdr := rr.Header()
+	return provider.DNSRecord{
+		Name:         hdr.Name,
+		Type:         dns.TypeToString[hdr.Rrtype],
+		Data:         strings.TrimPrefix(rr.String(), hdr.String()),
+		ProviderData: rr,
+	}
+}
+
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+func isSubdomain(name, zone string) bool {
+	name, zone = strings.ToLower(name), strings.ToLower(zone)
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// externalDNSArgsProcessor appends arguments to the external-dns container, as external-dns
+// doesn't read its rfc2136 settings from the environment.
+type externalDNSArgsProcessor struct {
+	Args []string
+}
+
+var _ gen.Processor = &externalDNSArgsProcessor{}
+
+func (pr *externalDNSArgsProcessor) Process(ctx context.Context, cd *gen.ChartData, p *keyval.Parameters, r io.Reader, w io.Writer) error {
+	return util.KYAMLFilter(r, w, util.KYAMLFilterFunc(
+		func(node *kyaml.RNode) (*kyaml.RNode, error) {
+			return node, util.KYAMLResourceMetaMatcher(node, util.KYAMLResourceMetaMatch{
+				Kind:      "Deployment",
+				Name:      "external-dns",
+				Namespace: constants.WorkshopctlNamespace,
+				Func: func() error {
+					args := make([]*kyaml.Node, 0, len(pr.Args))
+					for _, arg := range pr.Args {
+						args = append(args, kyaml.NewScalarRNode(arg).YNode())
+					}
+					return node.PipeE(
+						kyaml.LookupCreate(kyaml.SequenceNode, "spec", "template", "spec", "containers", "[name=external-dns]", "args"),
+						kyaml.Append(args...))
+				},
+			})
+		},
+	))
+}
+
+func traefikDNSEnv(nameserver, keyName, algorithm string) *kyaml.RNode {
+	return kyaml.MustParse(`
+- name: RFC2136_NAMESERVER
+  value: "` + nameserver + `"
+- name: RFC2136_TSIG_KEY
+  value: "` + keyName + `"
+- name: RFC2136_TSIG_ALGORITHM
+  value: "` + algorithm + `"
+- name: RFC2136_TSIG_SECRET
+  valueFrom:
+    secretKeyRef:
+      name: workshopctl
+      key: DNS_PROVIDER_SERVICEACCOUNT
+`)
+}
+
+var externalDNSEnvValue = kyaml.MustParse(`
+- name: RFC2136_TSIG_SECRET
+  valueFrom:
+    secretKeyRef:
+      name: workshopctl
+      key: DNS_PROVIDER_SERVICEACCOUNT
+`)
@@ -0,0 +1,132 @@
+package rfc2136
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/miekg/dns"
+)
+
+const (
+	testRootDomain = "example.com"
+	testKeyName    = "workshopctl."
+	testSecret     = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0"
+	// ownershipData is the TXT registry record external-dns creates next to its records
+	ownershipData = `"heritage=external-dns,external-dns/owner=workshopctl,external-dns/resource=ingress/workshopctl/traefik"`
+)
+
+func newTestProvider(t *testing.T, ctx context.Context, nameserver string) *RFC2136DNSProvider {
+	p, err := NewRFC2136DNSProvider(ctx, &config.Provider{
+		Name:           "rfc2136",
+		ServiceAccount: config.ServiceAccount{ServiceAccountContent: testSecret},
+		ProviderSpecific: map[string]string{
+			NameserverKey:  nameserver,
+			TSIGKeyNameKey: testKeyName,
+		},
+	}, testRootDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*RFC2136DNSProvider)
+}
+
+// testRecords are the records in the zone, of which the first four and the last one belong to cluster 01
+var testRecords = []dns.RR{
+	mustRR("*.cluster-01.example.com. 300 IN A 10.0.0.1"),
+	mustRR("*.cluster-01.example.com. 300 IN TXT " + ownershipData),
+	mustRR("cluster-01.example.com. 300 IN A 10.0.0.1"),
+	mustRR("cluster-01.example.com. 300 IN TXT " + ownershipData),
+	mustRR("cluster-011.example.com. 300 IN A 10.0.0.11"),
+	mustRR("cluster-011.example.com. 300 IN TXT " + ownershipData),
+	mustRR("cluster-02.example.com. 300 IN A 10.0.0.2"),
+	mustRR("cluster-02.example.com. 300 IN TXT " + ownershipData),
+	mustRR("example.com. 3600 IN NS ns1.example.com."),
+	// manual.cluster-01.example.com. wasn't created by external-dns
+	mustRR("manual.cluster-01.example.com. 300 IN A 10.0.0.100"),
+}
+
+func TestEnsureZone(t *testing.T) {
+	ctx := util.WithDryRun(context.Background(), false)
+	_, addr := startNameserver(t, "example.com.", testKeyName, testSecret)
+
+	if err := newTestProvider(t, ctx, addr).EnsureZone(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The nameserver isn't authoritative for other zones
+	_, otherAddr := startNameserver(t, "example.org.", testKeyName, testSecret)
+	if err := newTestProvider(t, ctx, otherAddr).EnsureZone(ctx); err == nil {
+		t.Error("expected an error for a nameserver that isn't authoritative for the zone")
+	}
+}
+
+func TestListRecords(t *testing.T) {
+	ctx := util.WithDryRun(context.Background(), false)
+	_, addr := startNameserver(t, "example.com.", testKeyName, testSecret, testRecords...)
+
+	// The zone is transferred also when dry-running
+	dryRunCtx := util.WithDryRun(context.Background(), true)
+	records, err := newTestProvider(t, ctx, addr).ListRecords(dryRunCtx, provider.ClusterMeta{Index: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range records {
+		got = append(got, r.Type+" "+r.Name)
+	}
+	sort.Strings(got)
+	want := []string{
+		"A *.cluster-01.example.com.",
+		"A cluster-01.example.com.",
+		"A manual.cluster-01.example.com.",
+		"TXT *.cluster-01.example.com.",
+		"TXT cluster-01.example.com.",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v, got %v", want, got)
+	}
+}
+
+func TestCleanupRecords(t *testing.T) {
+	ns, addr := startNameserver(t, "example.com.", testKeyName, testSecret, testRecords...)
+
+	// Nothing is deleted when dry-running
+	dryRunCtx := util.WithDryRun(context.Background(), true)
+	if err := newTestProvider(t, dryRunCtx, addr).CleanupRecords(dryRunCtx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if n := ns.updateCount(); n != 0 {
+		t.Fatalf("expected no updates when dry-running, got %d", n)
+	}
+
+	ctx := util.WithDryRun(context.Background(), false)
+	if err := newTestProvider(t, ctx, addr).CleanupRecords(ctx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"A cluster-011.example.com.",
+		"A cluster-02.example.com.",
+		"A manual.cluster-01.example.com.",
+		"NS example.com.",
+		"TXT cluster-011.example.com.",
+		"TXT cluster-02.example.com.",
+	}
+	if got := ns.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v to be kept, got %v", want, got)
+	}
+
+	// When forced, also records not created by external-dns are deleted
+	forceCtx := util.WithForce(ctx, true)
+	if err := newTestProvider(t, forceCtx, addr).CleanupRecords(forceCtx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want[:2], want[3:]...)
+	if got := ns.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v to be kept when forced, got %v", want, got)
+	}
+}
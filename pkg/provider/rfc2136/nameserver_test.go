@@ -0,0 +1,122 @@
+package rfc2136
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeNameserver is an authoritative nameserver for one zone, serving over TCP. It only answers
+// requests signed with its TSIG key: SOA queries for the zone, zone transfers and dynamic updates
+// that delete records.
+type fakeNameserver struct {
+	zone string
+
+	mu      sync.Mutex
+	records []dns.RR
+	// updates counts the received updates
+	updates int
+}
+
+// startNameserver starts a nameserver for the zone with the given records, and returns its address
+func startNameserver(t *testing.T, zone, keyName, secret string, records ...dns.RR) (*fakeNameserver, string) {
+	ns := &fakeNameserver{zone: zone, records: records}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		Listener:          l,
+		Handler:           ns,
+		TsigSecret:        map[string]string{keyName: secret},
+		NotifyStartedFunc: func() { close(started) },
+		// By default, the server refuses updates
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return ns, l.Addr().String()
+}
+
+func (ns *fakeNameserver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	resp := new(dns.Msg).SetReply(req)
+	switch {
+	case req.IsTsig() == nil || w.TsigStatus() != nil:
+		resp.Rcode = dns.RcodeRefused
+	case req.Opcode == dns.OpcodeUpdate && req.Question[0].Name == ns.zone:
+		ns.updates++
+		for _, del := range req.Ns {
+			ns.remove(del)
+		}
+	case req.Question[0].Qtype == dns.TypeAXFR && req.Question[0].Name == ns.zone:
+		ch := make(chan *dns.Envelope, 1)
+		ch <- &dns.Envelope{RR: append(append([]dns.RR{ns.soa()}, ns.records...), ns.soa())}
+		close(ch)
+		if err := new(dns.Transfer).Out(w, req, ch); err != nil {
+			panic(err)
+		}
+		return
+	case req.Question[0].Qtype == dns.TypeSOA && req.Question[0].Name == ns.zone:
+		resp.Authoritative = true
+		resp.Answer = []dns.RR{ns.soa()}
+	default:
+		resp.Rcode = dns.RcodeRefused
+	}
+	if tsig := req.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		resp.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
+	_ = w.WriteMsg(resp)
+}
+
+// remove deletes the record that the update deletes, i.e. which equals it except for the class
+func (ns *fakeNameserver) remove(del dns.RR) {
+	rr := dns.Copy(del)
+	rr.Header().Class = dns.ClassINET
+	kept := []dns.RR{}
+	for _, r := range ns.records {
+		if !dns.IsDuplicate(r, rr) {
+			kept = append(kept, r)
+		}
+	}
+	ns.records = kept
+}
+
+func (ns *fakeNameserver) soa() dns.RR {
+	return mustRR(ns.zone + " 3600 IN SOA ns1." + ns.zone + " hostmaster." + ns.zone + " 1 7200 3600 1209600 3600")
+}
+
+func (ns *fakeNameserver) updateCount() int {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.updates
+}
+
+// names returns the records in the zone as "<type> <name>", sorted
+func (ns *fakeNameserver) names() []string {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	names := []string{}
+	for _, rr := range ns.records {
+		names = append(names, dns.TypeToString[rr.Header().Rrtype]+" "+rr.Header().Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func mustRR(s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
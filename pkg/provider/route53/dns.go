@@ -0,0 +1,332 @@
+package route53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	r53 "github.com/aws/aws-sdk-go/service/route53"
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/config/keyval"
+	"github.com/cloud-native-nordics/workshopctl/pkg/constants"
+	"github.com/cloud-native-nordics/workshopctl/pkg/gen"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+	"github.com/sirupsen/logrus"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// Route53 is a global service, but the API still needs a region to sign requests for
+	DefaultRegion = "us-east-1"
+	RegionKey     = "region"
+	// EndpointKey allows pointing the provider at another API endpoint, e.g. a local mock for testing
+	EndpointKey = "endpoint"
+	// ProfileKey selects the profile of the shared credentials file to use
+	ProfileKey = "profile"
+
+	// Route53 allows at most 1000 changes per batch, stay well below that
+	maxChangesPerBatch = 100
+)
+
+// deletableTypes are the record types that external-dns manages
+var deletableTypes = map[string]bool{
+	r53.RRTypeA:     true,
+	r53.RRTypeAaaa:  true,
+	r53.RRTypeCname: true,
+	r53.RRTypeTxt:   true,
+}
+
+// NewRoute53DNSProvider returns a DNS provider for AWS Route53. The service account must be an
+// AWS shared credentials file, which is also mounted into the traefik and external-dns containers.
+func NewRoute53DNSProvider(ctx context.Context, p *config.Provider, rootDomain string) (provider.DNSProvider, error) {
+	region := DefaultRegion
+	if r, ok := p.ProviderSpecific[RegionKey]; ok {
+		region = r
+	}
+	awsCfg := aws.NewConfig().
+		WithRegion(region).
+		WithCredentials(credentials.NewSharedCredentials(util.JoinPaths(ctx, p.ServiceAccountPath), p.ProviderSpecific[ProfileKey]))
+	if endpoint, ok := p.ProviderSpecific[EndpointKey]; ok {
+		awsCfg = awsCfg.WithEndpoint(endpoint)
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Route53DNSProvider{
+		c:          r53.New(sess),
+		rootDomain: rootDomain,
+		region:     region,
+		profile:    p.ProviderSpecific[ProfileKey],
+		dryRun:     util.IsDryRun(ctx),
+	}, nil
+}
+
+type Route53DNSProvider struct {
+	c          *r53.Route53
+	rootDomain string
+	region     string
+	profile    string
+	dryRun     bool
+}
+
+func (r *Route53DNSProvider) ChartProcessors() []gen.Processor {
+	return []gen.Processor{
+		&provider.DNSEnvProcessor{
+			TraefikEnv:     dnsEnv(r.region, r.profile),
+			ExternalDNSEnv: dnsEnv(r.region, r.profile),
+		},
+		&credentialsProcessor{},
+	}
+}
+
+func (r *Route53DNSProvider) ValuesProcessors() []gen.Processor {
+	return nil
+}
+
+// EnsureZone makes sure there is a hosted zone for the root domain, and creates it if needed
+func (r *Route53DNSProvider) EnsureZone(ctx context.Context) error {
+	logger := util.Logger(ctx)
+
+	logger.Debugf("Ensuring domain %s is managed by Route53", r.rootDomain)
+	zone, err := r.getZone(ctx)
+	if err == nil {
+		util.DebugObject(ctx, "Hosted zone already exists", zone)
+		return nil
+	} else if !errors.Is(err, zoneNotFound) {
+		return err
+	}
+
+	if r.dryRun {
+		logger.Infof("Would create hosted zone %s in Route53", r.rootDomain)
+		return nil
+	}
+	logger.Infof("Creating hosted zone %s in Route53", r.rootDomain)
+	out, err := r.c.CreateHostedZoneWithContext(ctx, &r53.CreateHostedZoneInput{
+		Name:            aws.String(r.rootDomain),
+		CallerReference: aws.String(fmt.Sprintf("workshopctl-%d", time.Now().UnixNano())),
+		HostedZoneConfig: &r53.HostedZoneConfig{
+			Comment: aws.String("Created by workshopctl"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	util.DebugObject(ctx, "Created hosted zone", out.HostedZone)
+	if out.DelegationSet != nil {
+		logger.Warnf("Make sure %s has NS records pointing to %s", r.rootDomain, strings.Join(aws.StringValueSlice(out.DelegationSet.NameServers), ", "))
+	}
+	return nil
+}
+
+// ListRecords returns the record sets under the cluster domain
+func (r *Route53DNSProvider) ListRecords(ctx context.Context, m provider.ClusterMeta) ([]provider.DNSRecord, error) {
+	zone, err := r.getZone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.listRecords(ctx, zone, m)
+}
+
+func (r *Route53DNSProvider) listRecords(ctx context.Context, zone *r53.HostedZone, m provider.ClusterMeta) ([]provider.DNSRecord, error) {
+	logger := util.Logger(ctx)
+
+	clusterDomain := m.Index.Domain(r.rootDomain)
+	logger.Debugf("Listing the record sets of hosted zone %s under %s", aws.StringValue(zone.Id), clusterDomain)
+	records := []provider.DNSRecord{}
+	err := r.c.ListResourceRecordSetsPagesWithContext(ctx, &r53.ListResourceRecordSetsInput{
+		HostedZoneId: zone.Id,
+	}, func(page *r53.ListResourceRecordSetsOutput, _ bool) bool {
+		for _, rrs := range page.ResourceRecordSets {
+			name := unescapeName(aws.StringValue(rrs.Name))
+			logger.Debugf("Observed record: %s %s", aws.StringValue(rrs.Type), name)
+			if !provider.RecordBelongsTo(name, clusterDomain) {
+				continue
+			}
+			values := []string{}
+			for _, rr := range rrs.ResourceRecords {
+				values = append(values, aws.StringValue(rr.Value))
+			}
+			records = append(records, provider.DNSRecord{
+				Name:         name,
+				Type:         aws.StringValue(rrs.Type),
+				Data:         strings.Join(values, " "),
+				ProviderData: rrs,
+			})
+		}
+		return true
+	})
+	return records, err
+}
+
+func (r *Route53DNSProvider) CleanupRecords(ctx context.Context, m provider.ClusterMeta) error {
+	logger := util.Logger(ctx)
+
+	zone, err := r.getZone(ctx)
+	if err != nil {
+		return err
+	}
+	records, err := r.listRecords(ctx, zone, m)
+	if err != nil {
+		return err
+	}
+
+	clusterDomain := m.Index.Domain(r.rootDomain)
+	if util.IsForce(ctx) {
+		logger.Warnf("Deleting all records under %s, also those not created by external-dns", clusterDomain)
+	} else {
+		records = provider.OwnedRecords(records, clusterDomain)
+	}
+
+	changes := []*r53.Change{}
+	for _, record := range records {
+		if !deletableTypes[record.Type] {
+			continue
+		}
+		changes = append(changes, &r53.Change{
+			Action:            aws.String(r53.ChangeActionDelete),
+			ResourceRecordSet: record.ProviderData.(*r53.ResourceRecordSet),
+		})
+	}
+
+	for len(changes) > 0 {
+		n := len(changes)
+		if n > maxChangesPerBatch {
+			n = maxChangesPerBatch
+		}
+		if err := r.deleteRecords(ctx, zone, changes[:n], logger); err != nil {
+			return err
+		}
+		changes = changes[n:]
+	}
+	return nil
+}
+
+var zoneNotFound = errors.New("couldn't find hosted zone by name")
+
+func (r *Route53DNSProvider) getZone(ctx context.Context) (*r53.HostedZone, error) {
+	// Route53 zone names are always fully qualified
+	fqdn := strings.TrimSuffix(r.rootDomain, ".") + "."
+	out, err := r.c.ListHostedZonesByNameWithContext(ctx, &r53.ListHostedZonesByNameInput{
+		DNSName: aws.String(fqdn),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range out.HostedZones {
+		// The zones are sorted by name, starting from DNSName, hence other zones may follow
+		if aws.StringValue(zone.Name) == fqdn && !aws.BoolValue(zone.Config.PrivateZone) {
+			return zone, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", zoneNotFound, r.rootDomain)
+}
+
+func (r *Route53DNSProvider) deleteRecords(ctx context.Context, zone *r53.HostedZone, changes []*r53.Change, logger *logrus.Entry) error {
+	for _, change := range changes {
+		recordStr := fmt.Sprintf("%s %s", aws.StringValue(change.ResourceRecordSet.Type), unescapeName(aws.StringValue(change.ResourceRecordSet.Name)))
+		if r.dryRun {
+			logger.Infof("Would delete record: %s", recordStr)
+		} else {
+			logger.Infof("Deleting record: %s", recordStr)
+		}
+	}
+	if r.dryRun {
+		return nil
+	}
+	_, err := r.c.ChangeResourceRecordSetsWithContext(ctx, &r53.ChangeResourceRecordSetsInput{
+		HostedZoneId: zone.Id,
+		ChangeBatch: &r53.ChangeBatch{
+			Comment: aws.String("Cleanup by workshopctl"),
+			Changes: changes,
+		},
+	})
+	return err
+}
+
+// unescapeName turns Route53's octal escapes, e.g. "\052" for "*", back into characters
+func unescapeName(name string) string {
+	return strings.ReplaceAll(name, `\052`, "*")
+}
+
+const credentialsDir = "/etc/workshopctl/aws"
+
+// dnsEnv points the AWS SDK at the mounted shared credentials file. The profile is only set if
+// configured, as otherwise the SDK falls back to the default profile like workshopctl does.
+func dnsEnv(region, profile string) *kyaml.RNode {
+	env := `
+- name: AWS_SHARED_CREDENTIALS_FILE
+  value: ` + credentialsDir + `/credentials
+- name: AWS_REGION
+  value: ` + region + `
+`
+	if len(profile) != 0 {
+		env += `- name: AWS_PROFILE
+  value: ` + profile + `
+`
+	}
+	return kyaml.MustParse(env)
+}
+
+var (
+	credentialsVolume = kyaml.MustParse(`
+name: aws-credentials
+secret:
+  secretName: workshopctl
+  items:
+  - key: DNS_PROVIDER_SERVICEACCOUNT
+    path: credentials
+`)
+
+	credentialsVolumeMount = kyaml.MustParse(`
+name: aws-credentials
+mountPath: ` + credentialsDir + `
+readOnly: true
+`)
+)
+
+// credentialsProcessor mounts the shared credentials file from the workshopctl Secret into the
+// traefik and external-dns containers, as neither of them can read it from an env var.
+type credentialsProcessor struct{}
+
+var _ gen.Processor = &credentialsProcessor{}
+
+func (pr *credentialsProcessor) Process(ctx context.Context, cd *gen.ChartData, p *keyval.Parameters, r io.Reader, w io.Writer) error {
+	return util.KYAMLFilter(r, w, util.KYAMLFilterFunc(
+		func(node *kyaml.RNode) (*kyaml.RNode, error) {
+			return node, util.KYAMLResourceMetaMatcher(node, util.KYAMLResourceMetaMatch{
+				Kind:      "Deployment",
+				Name:      "traefik",
+				Namespace: constants.WorkshopctlNamespace,
+				Func: func() error {
+					return mountCredentials(node, "traefik")
+				},
+			}, util.KYAMLResourceMetaMatch{
+				Kind:      "Deployment",
+				Name:      "external-dns",
+				Namespace: constants.WorkshopctlNamespace,
+				Func: func() error {
+					return mountCredentials(node, "external-dns")
+				},
+			})
+		},
+	))
+}
+
+func mountCredentials(node *kyaml.RNode, container string) error {
+	if err := node.PipeE(
+		kyaml.LookupCreate(kyaml.SequenceNode, "spec", "template", "spec", "volumes"),
+		kyaml.Append(credentialsVolume.YNode())); err != nil {
+		return err
+	}
+	return node.PipeE(
+		kyaml.LookupCreate(kyaml.SequenceNode, "spec", "template", "spec", "containers", "[name="+container+"]", "volumeMounts"),
+		kyaml.Append(credentialsVolumeMount.YNode()))
+}
@@ -0,0 +1,297 @@
+package route53
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloud-native-nordics/workshopctl/pkg/config"
+	"github.com/cloud-native-nordics/workshopctl/pkg/provider"
+	"github.com/cloud-native-nordics/workshopctl/pkg/util"
+)
+
+const (
+	testRootDomain = "example.com"
+	testZoneID     = "Z0TEST"
+	// ownershipData is the TXT registry record external-dns creates next to its records
+	ownershipData = `"heritage=external-dns,external-dns/owner=workshopctl,external-dns/resource=ingress/workshopctl/traefik"`
+)
+
+type rrset struct {
+	Name   string   `xml:"Name"`
+	Type   string   `xml:"Type"`
+	TTL    int64    `xml:"TTL"`
+	Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+// fakeRoute53 is a minimal in-memory stand-in for the Route53 API, serving one public hosted
+// zone. Record sets are listed pageSize at a time, to exercise pagination.
+type fakeRoute53 struct {
+	mu       sync.Mutex
+	zone     string
+	records  []rrset
+	pageSize int
+	// batches records the amount of changes per ChangeResourceRecordSets call
+	batches []int
+	created []string
+}
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/2013-04-01")
+	switch {
+	case r.Method == http.MethodGet && path == "/hostedzonesbyname":
+		resp := `<ListHostedZonesByNameResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><HostedZones>`
+		if len(f.zone) != 0 {
+			resp += fmt.Sprintf(`<HostedZone><Id>/hostedzone/%s</Id><Name>%s</Name><CallerReference>test</CallerReference><Config><PrivateZone>false</PrivateZone></Config></HostedZone>`, testZoneID, f.zone)
+		}
+		resp += `</HostedZones><IsTruncated>false</IsTruncated><MaxItems>100</MaxItems></ListHostedZonesByNameResponse>`
+		writeXML(w, http.StatusOK, resp)
+
+	case r.Method == http.MethodPost && path == "/hostedzone":
+		req := struct {
+			Name string `xml:"Name"`
+		}{}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.created = append(f.created, req.Name)
+		writeXML(w, http.StatusCreated, fmt.Sprintf(`<CreateHostedZoneResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><HostedZone><Id>/hostedzone/%s</Id><Name>%s.</Name><CallerReference>test</CallerReference></HostedZone><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status><SubmittedAt>2021-01-01T00:00:00Z</SubmittedAt></ChangeInfo><DelegationSet><NameServers><NameServer>ns-1.awsdns-01.org</NameServer></NameServers></DelegationSet></CreateHostedZoneResponse>`, testZoneID, req.Name))
+
+	case r.Method == http.MethodGet && path == "/hostedzone/"+testZoneID+"/rrset":
+		start := 0
+		if name := r.URL.Query().Get("name"); len(name) != 0 {
+			for i, rrs := range f.records {
+				if rrs.Name == name && rrs.Type == r.URL.Query().Get("type") {
+					start = i
+				}
+			}
+		}
+		end := start + f.pageSize
+		if end > len(f.records) {
+			end = len(f.records)
+		}
+		resp := struct {
+			XMLName        xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ListResourceRecordSetsResponse"`
+			RRSets         []rrset  `xml:"ResourceRecordSets>ResourceRecordSet"`
+			IsTruncated    bool     `xml:"IsTruncated"`
+			NextRecordName string   `xml:"NextRecordName,omitempty"`
+			NextRecordType string   `xml:"NextRecordType,omitempty"`
+			MaxItems       int      `xml:"MaxItems"`
+		}{RRSets: f.records[start:end], IsTruncated: end < len(f.records), MaxItems: f.pageSize}
+		if resp.IsTruncated {
+			resp.NextRecordName, resp.NextRecordType = f.records[end].Name, f.records[end].Type
+		}
+		b, _ := xml.Marshal(resp)
+		writeXML(w, http.StatusOK, string(b))
+
+	case r.Method == http.MethodPost && strings.TrimSuffix(path, "/") == "/hostedzone/"+testZoneID+"/rrset":
+		req := struct {
+			Changes []struct {
+				Action string `xml:"Action"`
+				RRSet  rrset  `xml:"ResourceRecordSet"`
+			} `xml:"ChangeBatch>Changes>Change"`
+		}{}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.batches = append(f.batches, len(req.Changes))
+		for _, c := range req.Changes {
+			if c.Action != "DELETE" {
+				http.Error(w, "unexpected action "+c.Action, http.StatusBadRequest)
+				return
+			}
+			f.delete(c.RRSet)
+		}
+		writeXML(w, http.StatusOK, `<ChangeResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><ChangeInfo><Id>/change/C2</Id><Status>PENDING</Status><SubmittedAt>2021-01-01T00:00:00Z</SubmittedAt></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeRoute53) delete(del rrset) {
+	for i, rrs := range f.records {
+		if rrs.Name == del.Name && rrs.Type == del.Type {
+			f.records = append(f.records[:i], f.records[i+1:]...)
+			return
+		}
+	}
+}
+
+// names returns the "<type> <name>" of the remaining record sets
+func (f *fakeRoute53) names() []string {
+	names := []string{}
+	for _, rrs := range f.records {
+		names = append(names, rrs.Type+" "+rrs.Name)
+	}
+	return names
+}
+
+func writeXML(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+// ownedRecords returns an A record and its TXT registry record, as external-dns creates them
+func ownedRecords(name, ip string) []rrset {
+	return []rrset{
+		{Name: name, Type: "A", TTL: 300, Values: []string{ip}},
+		{Name: name, Type: "TXT", TTL: 300, Values: []string{ownershipData}},
+	}
+}
+
+func newTestProvider(t *testing.T, ctx context.Context, f *fakeRoute53) *Route53DNSProvider {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	if err := ioutil.WriteFile(credentialsFile, []byte("[default]\naws_access_key_id = AKIDTEST\naws_secret_access_key = secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The service account path is relative to the root path, which defaults to the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialsFile, err = filepath.Rel(wd, credentialsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewRoute53DNSProvider(ctx, &config.Provider{
+		Name:             "aws",
+		ServiceAccount:   config.ServiceAccount{ServiceAccountPath: credentialsFile},
+		ProviderSpecific: map[string]string{EndpointKey: srv.URL},
+	}, testRootDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*Route53DNSProvider)
+}
+
+func TestEnsureZone(t *testing.T) {
+	ctx := util.WithDryRun(context.Background(), false)
+
+	f := &fakeRoute53{zone: testRootDomain + "."}
+	if err := newTestProvider(t, ctx, f).EnsureZone(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.created) != 0 {
+		t.Errorf("expected the existing zone to be used, got %v created", f.created)
+	}
+
+	f = &fakeRoute53{}
+	if err := newTestProvider(t, ctx, f).EnsureZone(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.created) != 1 || f.created[0] != testRootDomain {
+		t.Errorf("expected zone %s to be created, got %v", testRootDomain, f.created)
+	}
+
+	f = &fakeRoute53{}
+	dryRunCtx := util.WithDryRun(context.Background(), true)
+	if err := newTestProvider(t, dryRunCtx, f).EnsureZone(dryRunCtx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.created) != 0 {
+		t.Errorf("expected no zone to be created when dry-running, got %v", f.created)
+	}
+}
+
+func TestListRecords(t *testing.T) {
+	ctx := util.WithDryRun(context.Background(), false)
+	f := &fakeRoute53{zone: testRootDomain + ".", pageSize: 2}
+	f.records = append(f.records, rrset{Name: testRootDomain + ".", Type: "NS", Values: []string{"ns-1.awsdns-01.org."}})
+	f.records = append(f.records, ownedRecords(`\052.cluster-01.example.com.`, "10.0.0.1")...)
+	f.records = append(f.records, ownedRecords("cluster-01.example.com.", "10.0.0.1")...)
+	f.records = append(f.records, ownedRecords("cluster-011.example.com.", "10.0.0.11")...)
+	f.records = append(f.records, ownedRecords("cluster-02.example.com.", "10.0.0.2")...)
+
+	records, err := newTestProvider(t, ctx, f).ListRecords(ctx, provider.ClusterMeta{Index: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range records {
+		got = append(got, r.Type+" "+r.Name)
+	}
+	want := []string{
+		"A *.cluster-01.example.com.",
+		"TXT *.cluster-01.example.com.",
+		"A cluster-01.example.com.",
+		"TXT cluster-01.example.com.",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v, got %v", want, got)
+	}
+}
+
+func TestCleanupRecords(t *testing.T) {
+	ctx := util.WithDryRun(context.Background(), false)
+	f := &fakeRoute53{zone: testRootDomain + ".", pageSize: 50}
+	f.records = append(f.records, rrset{Name: testRootDomain + ".", Type: "NS", Values: []string{"ns-1.awsdns-01.org."}})
+	// More records than fit into one batch
+	for i := 0; i < 60; i++ {
+		f.records = append(f.records, ownedRecords(fmt.Sprintf("app-%d.cluster-01.example.com.", i), "10.0.0.1")...)
+	}
+	f.records = append(f.records, ownedRecords("cluster-02.example.com.", "10.0.0.2")...)
+	// A record in the cluster domain that external-dns didn't create
+	f.records = append(f.records, rrset{Name: "manual.cluster-01.example.com.", Type: "A", TTL: 300, Values: []string{"10.0.0.100"}})
+
+	// Nothing is deleted when dry-running
+	dryRunCtx := util.WithDryRun(context.Background(), true)
+	if err := newTestProvider(t, dryRunCtx, f).CleanupRecords(dryRunCtx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.batches) != 0 {
+		t.Fatalf("expected no changes when dry-running, got %v", f.batches)
+	}
+
+	if err := newTestProvider(t, ctx, f).CleanupRecords(ctx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.batches) != 2 || f.batches[0] != maxChangesPerBatch || f.batches[1] != 20 {
+		t.Errorf("expected the 120 deletions in batches of %d, got %v", maxChangesPerBatch, f.batches)
+	}
+	want := []string{
+		"NS example.com.",
+		"A cluster-02.example.com.",
+		"TXT cluster-02.example.com.",
+		"A manual.cluster-01.example.com.",
+	}
+	if got := f.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v to be kept, got %v", want, got)
+	}
+
+	// When forced, also records not created by external-dns are deleted
+	forceCtx := util.WithForce(ctx, true)
+	if err := newTestProvider(t, forceCtx, f).CleanupRecords(forceCtx, provider.ClusterMeta{Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	want = want[:len(want)-1]
+	if got := f.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected records %v to be kept when forced, got %v", want, got)
+	}
+}
+
+func TestDNSEnv(t *testing.T) {
+	for profile, want := range map[string]bool{"": false, "workshops": true} {
+		env := dnsEnv(DefaultRegion, profile).MustString()
+		if got := strings.Contains(env, "name: AWS_PROFILE\n  value: workshops"); got != want {
+			t.Errorf("profile %q: expected AWS_PROFILE to be set %t, got env:\n%s", profile, want, env)
+		}
+	}
+}
@@ -50,6 +50,49 @@ func IsDryRun(ctx context.Context) bool {
 	return dryRun
 }
 
+var forceKey = forceKeyImpl{}
+
+type forceKeyImpl struct{}
+
+// WithForce tells the providers to also delete resources workshopctl can't prove it owns
+func WithForce(ctx context.Context, force bool) context.Context {
+	return context.WithValue(ctx, forceKey, force)
+}
+
+func IsForce(ctx context.Context) bool {
+	force, _ := ctx.Value(forceKey).(bool)
+	return force
+}
+
+var generateCredentialsKey = generateCredentialsKeyImpl{}
+
+type generateCredentialsKeyImpl struct{}
+
+// WithGenerateCredentials allows config.ForCluster to generate the login credentials of the
+// clusters, and persist them. Only gen and apply do that, other commands require them to exist.
+func WithGenerateCredentials(ctx context.Context, generate bool) context.Context {
+	return context.WithValue(ctx, generateCredentialsKey, generate)
+}
+
+func IsGenerateCredentials(ctx context.Context) bool {
+	generate, _ := ctx.Value(generateCredentialsKey).(bool)
+	return generate
+}
+
+var failFastKey = failFastKeyImpl{}
+
+type failFastKeyImpl struct{}
+
+// WithFailFast makes config.ForCluster cancel the operation for all clusters when one fails
+func WithFailFast(ctx context.Context, failFast bool) context.Context {
+	return context.WithValue(ctx, failFastKey, failFast)
+}
+
+func IsFailFast(ctx context.Context) bool {
+	failFast, _ := ctx.Value(failFastKey).(bool)
+	return failFast
+}
+
 var rootPathKey = rootPathKeyImpl{}
 
 type rootPathKeyImpl struct{}
@@ -82,21 +125,58 @@ func JoinPaths(ctx context.Context, filePaths ...string) string {
 	return filepath.Join(filePaths...)
 }
 
-var muxKey = muxKeyImpl{}
+// Names of the locks shared by the cluster goroutines
+const (
+	// LockGit guards the local clone of the git repo, and pushes to it
+	LockGit = "git"
+	// LockHelmRepos guards the list of helm repos
+	LockHelmRepos = "helm-repos"
+	// LockCacheTmp guards the .cache/tmp directory charts are downloaded to
+	LockCacheTmp = "cache-tmp"
+	// LockDNS guards writes to the DNS zone
+	LockDNS = "dns"
+)
+
+var locksKey = locksKeyImpl{}
+
+type locksKeyImpl struct{}
+
+// lockRegistry holds one mutex per key, so that unrelated critical sections don't block each other
+type lockRegistry struct {
+	mux   sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (r *lockRegistry) get(key string) *sync.Mutex {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	l, ok := r.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		r.locks[key] = l
+	}
+	return l
+}
 
-type muxKeyImpl struct{}
+// defaultLocks is used when the context doesn't carry a lock registry
+var defaultLocks = &lockRegistry{locks: map[string]*sync.Mutex{}}
 
-func WithMutex(ctx context.Context, mux *sync.Mutex) context.Context {
-	return context.WithValue(ctx, muxKey, mux)
+// WithLocks returns a context with a new lock registry, shared by all contexts derived from it
+func WithLocks(ctx context.Context) context.Context {
+	return context.WithValue(ctx, locksKey, &lockRegistry{locks: map[string]*sync.Mutex{}})
 }
 
-func GetMutex(ctx context.Context) (*sync.Mutex, bool) {
-	mux, ok := ctx.Value(muxKey).(*sync.Mutex)
+// Lock blocks until the lock with the given key is acquired, and returns a function releasing it
+func Lock(ctx context.Context, key string) func() {
+	r, ok := ctx.Value(locksKey).(*lockRegistry)
 	if !ok {
-		logrus.Debug("Didn't find mux from context, defaulting to nil")
-		return nil, false
+		logrus.Debug("Didn't find lock registry from context, defaulting to the global one")
+		r = defaultLocks
 	}
-	return mux, ok
+	l := r.get(key)
+	Logger(ctx).Tracef("Waiting for lock %q", key)
+	l.Lock()
+	return l.Unlock
 }
 
 func Logger(ctx context.Context) *logrus.Entry {
@@ -223,6 +223,13 @@ func Command(ctx context.Context, command string, args ...string) *ExecUtil {
 	}
 }
 
+// ReadOnlyCommand is like Command, but runs the command also when dry-running. It must only be
+// used for commands that don't change anything, e.g. ones that get or list resources, as dry-runs
+// otherwise couldn't tell what would be done.
+func ReadOnlyCommand(ctx context.Context, command string, args ...string) *ExecUtil {
+	return Command(WithDryRun(ctx, false), command, args...)
+}
+
 func ShellCommand(ctx context.Context, format string, args ...interface{}) *ExecUtil {
 	return Command(ctx, "/bin/sh", "-c", fmt.Sprintf(format, args...))
 }